@@ -2,230 +2,787 @@ package eqdraw
 
 import (
 	"fmt"
-	"strings"
+	"sort"
 	"unicode/utf8"
 )
 
-type specKind uint8
+type tokenKind uint8
 
-// Valid specKind values.
+// Valid tokenKind values.
 const (
-	kindTerms = iota
-	kindParenthesis
-	kindRoot
+	tokEOF          tokenKind = iota
+	tokTerm                   // An unquoted term, such as 12 or mx.
+	tokQuoted                 // A quoted term.
+	tokOp                     // One of + - * / ^ _ =
+	tokOpen                   // Start parenthesis.
+	tokClose                  // End parenthesis.
+	tokFunc                   // A function name immediately followed by '(', such as sqrt(.
+	tokComma                  // A comma separating arguments, or the rows or cells of a matrix.
+	tokOpenBracket            // The start of a matrix, or of a row within one.
+	tokCloseBracket           // The end of a matrix, or of a row within one.
+	tokRadical                // A radical sign taking the following operand, such as ∛.
 )
 
-type termType uint8
+// asciiFuncs are the names which begin a function when followed by '('.
+var asciiFuncs = map[string]bool{
+	"sqrt": true, "root": true,
+	"sum": true, "prod": true, "coprod": true, "int": true, "oint": true,
+}
+
+// asciiBigOps maps the names of functions which draw a large operator to
+// the operator. Their arguments are separated by commas: the body alone, the
+// lower limit and body, or the lower limit, upper limit and body, such as
+// sum(i=1, n, i).
+var asciiBigOps = map[string]rune{
+	"sum": OpSum, "prod": OpProduct, "coprod": OpCoproduct,
+	"int": OpIntegral, "oint": OpContourIntegral,
+}
+
+// asciiRadicals maps the radical signs which draw a root of the operand
+// following them to the index of the root.
+var asciiRadicals = map[rune]string{
+	'∛': "3", '∜': "4",
+}
+
+func isASCIIRadical(c rune) bool {
+	return asciiRadicals[c] != ""
+}
 
+// takesArgs returns true if the parentheses of the function name separate
+// its arguments with commas: those of a large operator, and of root, whose
+// arguments are the index and the radicand, such as root(n, x).
+func takesArgs(name string) bool {
+	_, isBigOp := asciiBigOps[name]
+	return isBigOp || name == "root"
+}
+
+type token struct {
+	kind tokenKind
+	val  []rune
+	// pos is the position of the token in the input, counted in runes and
+	// starting from 1.
+	pos int
+	// off is the offset of the token in the input in bytes, and n is its
+	// length in runes.
+	off, n int
+}
+
+func (t token) String() string {
+	if t.kind == tokEOF {
+		return "end of input"
+	}
+	return fmt.Sprintf("%q", string(t.val))
+}
+
+// errorf returns a ParseError for the input spanned by t.
+func (t token) errorf(kind ErrorKind, format string, args ...interface{}) *ParseError {
+	return &ParseError{Pos: t.pos, Offset: t.off, Len: t.n, Kind: kind, Msg: fmt.Sprintf(format, args...)}
+}
+
+func isASCIIOp(c rune) bool {
+	switch c {
+	case '+', '-', '*', '/', '^', '_', '=':
+		return true
+	}
+	return false
+}
+
+// lexGroup describes a group which is open during lexing.
+type lexGroup uint8
+
+// Valid lexGroup values.
 const (
-	termNormal termType = iota
-	termBinOp
+	groupParen  lexGroup = iota // Parentheses, or the argument of sqrt.
+	groupArgs                   // The parentheses of a large operator, or of root.
+	groupMatrix                 // The brackets around the rows of a matrix.
+	groupRow                    // The brackets around a row of a matrix.
 )
 
-type eqSpec struct {
-	kind  specKind
-	terms []node
-}
+// lexASCII splits an ascii equation into tokens. Commas separate terms,
+// except directly within the parentheses of a large operator, where they
+// separate its arguments, and within a matrix, where they separate its rows
+// and cells. A matrix starts with two brackets, such as [[a, b], [c, d]];
+// brackets elsewhere are part of a term. If a quote is not terminated, an
+// error is returned along with the tokens, the last of which is the quoted
+// term running to the end of the input.
+func lexASCII(inp string) ([]token, *ParseError) {
+	var (
+		out         []token
+		accumulator []rune
+		accPos      int
+		accOff      int
+		// groups holds the groups which are open.
+		groups []lexGroup
+	)
+	top := func() lexGroup {
+		if len(groups) == 0 {
+			return groupParen
+		}
+		return groups[len(groups)-1]
+	}
+	flush := func() {
+		if len(accumulator) > 0 {
+			out = append(out, token{kind: tokTerm, val: accumulator, pos: accPos, off: accOff, n: len(accumulator)})
+			accumulator = nil
+		}
+	}
+
+	var lexErr *ParseError
+	input := []byte(inp)
+	pos, off := 0, 0
+	for len(input) > 0 {
+		c, size := utf8.DecodeRune(input)
+		input = input[size:]
+		pos++
+		start, startOff := pos, off
+		off += size
+
+		switch {
+		case c == '\'': // Quoted term
+			flush()
+			var quoted []rune
+			for {
+				if len(input) == 0 {
+					lexErr = &ParseError{Pos: start, Offset: startOff, Len: pos - start + 1, Kind: KindUnmatched, Msg: "unterminated quote"}
+					break
+				}
+				c, size = utf8.DecodeRune(input)
+				input = input[size:]
+				pos++
+				off += size
+				if c == '\'' {
+					break
+				}
+				quoted = append(quoted, c)
+			}
+			out = append(out, token{kind: tokQuoted, val: quoted, pos: start, off: startOff, n: pos - start + 1})
+
+		case c == '(':
+			if asciiFuncs[string(accumulator)] {
+				g := groupParen
+				if takesArgs(string(accumulator)) {
+					g = groupArgs
+				}
+				groups = append(groups, g)
+				out = append(out, token{kind: tokFunc, val: accumulator, pos: accPos, off: accOff, n: len(accumulator) + 1})
+				accumulator = nil
+			} else {
+				flush()
+				groups = append(groups, groupParen)
+				out = append(out, token{kind: tokOpen, val: []rune{c}, pos: pos, off: startOff, n: 1})
+			}
+
+		case c == ')':
+			flush()
+			if g := top(); len(groups) > 0 && (g == groupParen || g == groupArgs) {
+				groups = groups[:len(groups)-1]
+			}
+			out = append(out, token{kind: tokClose, val: []rune{c}, pos: pos, off: startOff, n: 1})
+
+		case c == '[' && (top() == groupMatrix || (len(input) > 0 && input[0] == '[')):
+			flush()
+			g := groupMatrix
+			if top() == groupMatrix {
+				g = groupRow
+			}
+			groups = append(groups, g)
+			out = append(out, token{kind: tokOpenBracket, val: []rune{c}, pos: pos, off: startOff, n: 1})
+
+		case c == ']' && (top() == groupMatrix || top() == groupRow):
+			flush()
+			groups = groups[:len(groups)-1]
+			out = append(out, token{kind: tokCloseBracket, val: []rune{c}, pos: pos, off: startOff, n: 1})
+
+		case c == ',' && top() != groupParen:
+			flush()
+			out = append(out, token{kind: tokComma, val: []rune{c}, pos: pos, off: startOff, n: 1})
+
+		case c == ',' || c == ' ': // End of term
+			flush()
+
+		case isASCIIOp(c):
+			flush()
+			out = append(out, token{kind: tokOp, val: []rune{c}, pos: pos, off: startOff, n: 1})
+
+		case isASCIIRadical(c):
+			flush()
+			out = append(out, token{kind: tokRadical, val: []rune{c}, pos: pos, off: startOff, n: 1})
 
-func (s eqSpec) String() string {
-	var b strings.Builder
-	for _, t := range s.terms {
-		switch n := t.(type) {
-		case *Term:
-			b.WriteString(string(n.Content))
 		default:
-			b.WriteString(fmt.Sprint(t))
+			if len(accumulator) == 0 {
+				accPos, accOff = pos, startOff
+			}
+			accumulator = append(accumulator, c)
 		}
 	}
-	return b.String()
+	flush()
+	return append(out, token{kind: tokEOF, pos: pos + 1, off: off}), lexErr
 }
 
-// postProcess splits a sequence of terms containing a '/' symbol, into the
-// numerator + denominator under a new Div node.
-func (s *eqSpec) postProcess() {
-	idx := -1
-	for i, n := range s.terms {
-		if t, ok := n.(*Term); ok && string(t.Content) == "/" {
-			idx = i
-		}
+// asciiParser is a recursive-descent parser over the tokens of an ascii
+// equation. From lowest to highest precedence, the levels are:
+//   - '=' (relation)
+//   - '+' and '-' (additive)
+//   - '*' and juxtaposition, such as 2(x+1) (multiplicative)
+//   - '/' (division), which binds only its immediate operands
+//   - '^' and '_' (scripts), which are right-associative
+//
+// Sequences of operands at the relation, additive and multiplicative levels
+// are flattened into a single Run.
+//
+// A tolerant parser records errors in diags rather than returning them, and
+// recovers by substituting a placeholder for missing operands and closing
+// any open parentheses.
+type asciiParser struct {
+	toks     []token
+	i        int
+	tolerant bool
+	diags    []*ParseError
+}
+
+// Placeholder is the rune of the term drawn in place of a missing operand
+// by ParseASCIIEquationTolerant.
+const Placeholder = '□'
+
+func placeholder() Node {
+	return &Term{Content: []rune{Placeholder}}
+}
+
+// tolerate records err if the parser is tolerant, returning false if
+// parsing must instead stop with err. A token which could not be parsed is
+// reported both where it was found and where parsing recovers from it, so
+// an error identical to the last one recorded is dropped.
+func (p *asciiParser) tolerate(err *ParseError) bool {
+	if !p.tolerant {
+		return false
+	}
+	if n := len(p.diags); n == 0 || *p.diags[n-1] != *err {
+		p.diags = append(p.diags, err)
 	}
+	return true
+}
 
-	if idx > 0 {
-		// Don't capture anything delimited by an equals sign.
-		var (
-			candidates = s.terms[:idx]
-			num        = []node{}
-			remaining  = []node{}
-		)
-	l:
-		for i := len(candidates) - 1; i > 0; i-- {
-			if t, isTerm := candidates[i].(*Term); isTerm && string(t.Content) == "=" {
-				remaining = append(remaining, candidates[:i]...)
-				remaining = append(remaining, t)
-				num = append(num, candidates[i+1:]...)
-				break l
-			}
+func (p *asciiParser) peek() token {
+	return p.toks[p.i]
+}
+
+func (p *asciiParser) next() token {
+	t := p.toks[p.i]
+	if t.kind != tokEOF {
+		p.i++
+	}
+	return t
+}
+
+// peekOp returns true if the next token is one of the given operators.
+func (p *asciiParser) peekOp(ops string) bool {
+	t := p.peek()
+	if t.kind != tokOp {
+		return false
+	}
+	for _, op := range ops {
+		if t.val[0] == op {
+			return true
 		}
-		if len(num) == 0 {
-			num = candidates
+	}
+	return false
+}
+
+// startsOperand returns true if t can begin an operand.
+func startsOperand(t token) bool {
+	switch t.kind {
+	case tokTerm, tokQuoted, tokOpen, tokFunc, tokOpenBracket, tokRadical:
+		return true
+	}
+	return false
+}
+
+// unexpected returns an error describing the next token, which could not
+// be parsed.
+func (p *asciiParser) unexpected() *ParseError {
+	t := p.peek()
+	var prev token
+	if p.i > 0 {
+		prev = p.toks[p.i-1]
+	}
+	switch {
+	case (t.kind == tokEOF || t.kind == tokClose || t.kind == tokComma || t.kind == tokCloseBracket) && (prev.kind == tokOp || prev.kind == tokRadical):
+		return prev.errorf(KindMissingOperand, "missing operand after %s", prev)
+	case t.kind == tokClose:
+		return t.errorf(KindUnmatched, "unmatched end parenthesis")
+	case t.kind == tokEOF && p.i > 0:
+		return prev.errorf(KindMissingOperand, "missing operand after %s", prev)
+	}
+	return t.errorf(KindUnexpected, "unexpected %s", t)
+}
+
+// parseRelation parses terms separated by '='.
+func (p *asciiParser) parseRelation() ([]Node, error) {
+	out, err := p.parseAdditive()
+	if err != nil {
+		return nil, err
+	}
+	for p.peekOp("=") {
+		out = append(out, &Term{Content: p.next().val})
+		rhs, err := p.parseAdditive()
+		if err != nil {
+			return nil, err
 		}
-		// fmt.Printf("remaining = %+v, num = %+v\n", remaining, num)
+		out = append(out, rhs...)
+	}
+	return out, nil
+}
 
-		var tmp eqSpec
-		tmp.pushNode(eqSpec{terms: num})
-		tmp.pushNode(eqSpec{terms: s.terms[idx+1:]})
-		d := &Div{
-			Numerator:   tmp.terms[0],
-			Denominator: tmp.terms[1],
+// parseAdditive parses terms separated by '+' or '-'.
+func (p *asciiParser) parseAdditive() ([]Node, error) {
+	out, err := p.parseMultiplicative()
+	if err != nil {
+		return nil, err
+	}
+	for p.peekOp("+-") {
+		out = append(out, &Term{Content: p.next().val})
+		rhs, err := p.parseMultiplicative()
+		if err != nil {
+			return nil, err
 		}
-		if paren, isParenth := d.Numerator.(*Parenthesis); isParenth {
-			d.Numerator = paren.Term
+		out = append(out, rhs...)
+	}
+	return out, nil
+}
+
+// parseMultiplicative parses terms separated by '*', or juxtaposed.
+func (p *asciiParser) parseMultiplicative() ([]Node, error) {
+	out, err := p.parseSigned()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		switch {
+		case p.peekOp("*"):
+			out = append(out, &Term{Content: p.next().val})
+		case startsOperand(p.peek()):
+		default:
+			return out, nil
 		}
-		if paren, isParenth := d.Denominator.(*Parenthesis); isParenth {
-			d.Denominator = paren.Term
+		rhs, err := p.parseSigned()
+		if err != nil {
+			return nil, err
 		}
+		out = append(out, rhs...)
+	}
+}
 
-		if len(remaining) > 0 {
-			s.terms = append(remaining, d)
-		} else {
-			s.terms = []node{d}
-		}
+// parseSigned parses a division, optionally preceded by a unary '+' or '-'.
+func (p *asciiParser) parseSigned() ([]Node, error) {
+	var out []Node
+	if p.peekOp("+-") {
+		out = append(out, &Term{Content: p.next().val})
+	}
+	n, err := p.parseDivision()
+	if err != nil {
+		return nil, err
 	}
+	return append(out, n), nil
 }
 
-func (s *eqSpec) push(term []rune, kind termType) {
-	if len(term) == 0 {
-		return
+// groupOperand returns the node to use as the operand of a division or a
+// script, dropping any parentheses which were only used for grouping.
+func groupOperand(n Node) Node {
+	if paren, isParenth := n.(*Parenthesis); isParenth && paren.Term != nil {
+		return paren.Term
+	}
+	return n
+}
+
+// parseDivision parses operands separated by '/'. Divisions are
+// left-associative.
+func (p *asciiParser) parseDivision() (Node, error) {
+	out, err := p.parseScripts()
+	if err != nil {
+		return nil, err
+	}
+	for p.peekOp("/") {
+		p.next()
+		sign := p.parseSign()
+		den, err := p.parseScripts()
+		if err != nil {
+			return nil, err
+		}
+		out = &Div{
+			Numerator:   groupOperand(out),
+			Denominator: seqNode(append(sign, groupOperand(den))),
+		}
 	}
+	return out, nil
+}
 
-	switch kind {
-	case termNormal:
-		s.terms = append(s.terms, &Term{Content: term})
-	case termBinOp:
-		s.terms = append(s.terms, &Term{Content: term})
+// parseSign parses the sign of a signed operand, such as the denominator
+// in 1/-x or the exponent in x^-1, returning nil if there is none.
+func (p *asciiParser) parseSign() []Node {
+	if p.peekOp("+-") {
+		return []Node{&Term{Content: p.next().val}}
 	}
+	return nil
 }
 
-func (s *eqSpec) pushNode(in eqSpec) {
-	in.postProcess()
+// parseScripts parses an operand, and any exponent or index attached to it.
+// Exponents and indices may be signed, such as in x^-1.
+func (p *asciiParser) parseScripts() (Node, error) {
+	base, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
 
-	var out node
-	switch len(in.terms) {
-	case 0:
-		return
-	case 1:
-		out = in.terms[0]
-	default:
-		out = &Run{Terms: in.terms}
+	var exp, idx Node
+	for p.peekOp("^_") {
+		op := p.next()
+		sign := p.parseSign()
+		var arg Node
+		if op.val[0] == '^' {
+			// Parse the exponent with its own exponents, so a^b^c is
+			// read as a^(b^c).
+			arg, err = p.parseExponent()
+		} else {
+			arg, err = p.parseOperand()
+		}
+		if err != nil {
+			return nil, err
+		}
+		arg = seqNode(append(sign, groupOperand(arg)))
+
+		var dup *ParseError
+		switch {
+		case op.val[0] == '^' && exp != nil:
+			dup = op.errorf(KindUnexpected, "multiple exponents")
+		case op.val[0] == '_' && idx != nil:
+			dup = op.errorf(KindUnexpected, "multiple indices")
+		}
+		if dup != nil {
+			if !p.tolerate(dup) {
+				return nil, dup
+			}
+			// Attach the script to everything before it instead.
+			base, exp, idx = scriptNode(base, exp, idx), nil, nil
+		}
+		if op.val[0] == '^' {
+			exp = arg
+		} else {
+			idx = arg
+		}
 	}
+	return scriptNode(base, exp, idx), nil
+}
 
-	switch in.kind {
-	case kindRoot:
-		s.terms = append(s.terms, &Root{Term: out})
-	case kindParenthesis:
-		s.terms = append(s.terms, &Parenthesis{Term: out})
-	default:
-		s.terms = append(s.terms, out)
+// scriptNode returns the node for base with the given exponent and index,
+// either of which may be nil.
+func scriptNode(base, exp, idx Node) Node {
+	switch {
+	case idx != nil:
+		return &Sub{Base: base, Index: idx, Exponent: exp}
+	case exp != nil:
+		return &Sup{Base: base, Exponent: exp}
 	}
+	return base
 }
 
-func binOp(in rune) bool {
-	switch in {
-	case '+', '-', '*', '/':
-		return true
+// parseExponent parses an operand, and any chain of exponents attached to
+// it.
+func (p *asciiParser) parseExponent() (Node, error) {
+	base, err := p.parseOperand()
+	if err != nil {
+		return nil, err
 	}
-	return false
+	if !p.peekOp("^") {
+		return base, nil
+	}
+	p.next()
+	sign := p.parseSign()
+	exp, err := p.parseExponent()
+	if err != nil {
+		return nil, err
+	}
+	return &Sup{Base: base, Exponent: seqNode(append(sign, groupOperand(exp)))}, nil
 }
 
-// ParseASCIIEquation attempts to generate the node tree by parsing an
-// ascii representation of the equation.
-func ParseASCIIEquation(inp string) (node, error) {
-	var (
-		nextTerm    termType
-		inQuotes    = false
-		quoteChar   = '\''
-		accumulator []rune
-		out         eqSpec
-		stack       []eqSpec
-	)
+// parseOperand parses a term, parenthesized group, function or matrix.
+func (p *asciiParser) parseOperand() (Node, error) {
+	t := p.peek()
+	switch t.kind {
+	case tokTerm, tokQuoted:
+		p.next()
+		return &Term{Content: t.val}, nil
 
-	input := []byte(inp)
-	pos := 0
-	for len(input) > 0 {
-		c, size := utf8.DecodeRune(input)
-		input = input[size:]
-		pos++
+	case tokOpenBracket:
+		return p.parseMatrix()
+
+	case tokRadical:
+		p.next()
+		n, err := p.parseOperand()
+		if err != nil {
+			return nil, err
+		}
+		return &Root{Term: n, Index: &Term{Content: []rune(asciiRadicals[t.val[0]])}}, nil
+
+	case tokOpen, tokFunc:
+		p.next()
+		var (
+			inner []Node
+			args  [][]Node // The arguments before inner, for large operators.
+		)
+		for {
+			if k := p.peek().kind; k != tokClose && k != tokEOF && k != tokComma {
+				var err error
+				if inner, err = p.parseRelation(); err != nil {
+					return nil, err
+				}
+			}
+			if p.peek().kind != tokComma {
+				break
+			}
+			p.next()
+			args, inner = append(args, inner), nil
+		}
+		switch c := p.peek(); {
+		case c.kind == tokClose:
+			p.next()
+		case c.kind == tokEOF:
+			// Tolerant parsers close the parenthesis at the end of input.
+			if err := t.errorf(KindUnmatched, "unmatched start parenthesis"); !p.tolerate(err) {
+				return nil, err
+			}
+		default:
+			return nil, p.unexpected()
+		}
+
+		if t.kind == tokOpen {
+			return &Parenthesis{Term: seqNode(inner)}, nil
+		}
+		if op, ok := asciiBigOps[string(t.val)]; ok {
+			return p.bigOp(t, op, append(args, inner))
+		}
+		if string(t.val) == "root" {
+			return p.root(t, append(args, inner))
+		}
+		if len(inner) == 0 {
+			if err := t.errorf(KindMissingOperand, "missing argument to %s", string(t.val)); !p.tolerate(err) {
+				return nil, err
+			}
+			inner = []Node{placeholder()}
+		}
+		return &Root{Term: seqNode(inner)}, nil
+	}
+
+	if err := p.unexpected(); !p.tolerate(err) {
+		return nil, err
+	}
+	return placeholder(), nil
+}
 
+// parseMatrix parses a matrix, written as a bracketed list of rows, each of
+// which is a bracketed list of cells.
+func (p *asciiParser) parseMatrix() (Node, error) {
+	open := p.next()
+	out := &Matrix{Delims: DelimBrackets}
+	afterRow := false
+	for {
+		t := p.peek()
 		switch {
-		case inQuotes && c == quoteChar: // Terminating quote reached
-			out.push(accumulator, nextTerm)
-			accumulator = []rune{}
-			nextTerm = termNormal
-			inQuotes = false
+		case t.kind == tokOpenBracket:
+			if afterRow {
+				// Tolerant parsers read the row as though a comma preceded it.
+				if err := t.errorf(KindUnexpected, "unexpected %s", t); !p.tolerate(err) {
+					return nil, err
+				}
+			}
+			row, err := p.parseRow()
+			if err != nil {
+				return nil, err
+			}
+			out.Rows = append(out.Rows, row)
+			afterRow = true
 
-		case inQuotes: // Still in a quoted term
-			accumulator = append(accumulator, c)
+		case t.kind == tokComma && afterRow:
+			p.next()
+			afterRow = false
+
+		case t.kind == tokCloseBracket && afterRow:
+			p.next()
+			return out, nil
 
-		case !inQuotes && c == '\'': // New quoted term
-			inQuotes = true
-			quoteChar = '\''
-
-		case !inQuotes && c == '(': // Start parenthesis
-			switch {
-			case string(accumulator) == "sqrt":
-				stack = append(stack, out)
-				out = eqSpec{kind: kindRoot}
-			default:
-				out.push(accumulator, nextTerm)
-				stack = append(stack, out)
-				out = eqSpec{kind: kindParenthesis}
-			}
-			accumulator = []rune{}
-			nextTerm = termNormal
-
-		case !inQuotes && c == ')': // End parenthesis
-			out.push(accumulator, nextTerm)
-			accumulator = []rune{}
-			nextTerm = termNormal
-			if len(stack) == 0 {
-				return nil, fmt.Errorf("unmatched end parenthesis at position %d", pos)
-			}
-			tmp := out
-			out = stack[len(stack)-1]
-			stack = stack[:len(stack)-1]
-			out.pushNode(tmp)
-
-		case !inQuotes && (c == ',' || c == ' '): // End of term
-			out.push(accumulator, nextTerm)
-			accumulator = []rune{}
-			nextTerm = termNormal
-
-		case !inQuotes && binOp(c): // Split on binary op
-			out.push(accumulator, nextTerm)
-			accumulator = []rune{}
-			out.push([]rune{c}, termBinOp)
-			nextTerm = termNormal
+		case t.kind == tokEOF:
+			// Tolerant parsers close the matrix at the end of input.
+			if err := open.errorf(KindUnmatched, "unmatched start bracket"); !p.tolerate(err) {
+				return nil, err
+			}
+			return out, nil
+
+		case t.kind == tokCloseBracket:
+			if err := t.errorf(KindMissingOperand, "missing row after %s", p.toks[p.i-1]); !p.tolerate(err) {
+				return nil, err
+			}
+			p.next()
+			return out, nil
 
 		default:
-			accumulator = append(accumulator, c)
-			switch accumulator {
+			// Tolerant parsers skip anything else between rows.
+			if err := p.unexpected(); !p.tolerate(err) {
+				return nil, err
+			}
+			p.next()
+		}
+	}
+}
+
+// parseRow parses a row of a matrix. Cells may be empty.
+func (p *asciiParser) parseRow() ([]Node, error) {
+	open := p.next()
+	var out []Node
+	for {
+		var cell []Node
+		if k := p.peek().kind; k != tokComma && k != tokCloseBracket && k != tokEOF && k != tokClose {
+			var err error
+			if cell, err = p.parseRelation(); err != nil {
+				return nil, err
+			}
+		}
+		out = append(out, seqNode(cell))
 
+		switch p.peek().kind {
+		case tokComma:
+			p.next()
+		case tokCloseBracket:
+			p.next()
+			return out, nil
+		case tokEOF:
+			if err := open.errorf(KindUnmatched, "unmatched start bracket"); !p.tolerate(err) {
+				return nil, err
+			}
+			return out, nil
+		default:
+			// Tolerant parsers skip unmatched end parentheses, and read
+			// what follows as another cell.
+			if err := p.unexpected(); !p.tolerate(err) {
+				return nil, err
 			}
+			p.next()
+		}
+	}
+}
+
+// bigOp returns the large operator for the function t, given its
+// arguments. Empty limits are omitted.
+func (p *asciiParser) bigOp(t token, op rune, args [][]Node) (Node, error) {
+	if len(args) > 3 {
+		if err := t.errorf(KindUnexpected, "too many arguments to %s", string(t.val)); !p.tolerate(err) {
+			return nil, err
+		}
+		// Keep the limits, and use the last argument as the body.
+		args = append(args[:2], args[len(args)-1])
+	}
+	body := args[len(args)-1]
+	if len(body) == 0 {
+		if err := t.errorf(KindMissingOperand, "missing argument to %s", string(t.val)); !p.tolerate(err) {
+			return nil, err
 		}
+		body = []Node{placeholder()}
 	}
-	out.push(accumulator, nextTerm)
 
-	if len(stack) != 0 {
-		return nil, fmt.Errorf("unmatched start parenthesis")
+	out := &BigOp{Op: op, Body: seqNode(body)}
+	switch len(args) {
+	case 3:
+		out.Upper = seqNode(args[1])
+		fallthrough
+	case 2:
+		out.Lower = seqNode(args[0])
+	}
+	return out, nil
+}
+
+// root returns the root written by the function t with the given
+// arguments: the index and the radicand, or the radicand alone. An empty
+// index draws a square root.
+func (p *asciiParser) root(t token, args [][]Node) (Node, error) {
+	if len(args) > 2 {
+		if err := t.errorf(KindUnexpected, "too many arguments to %s", string(t.val)); !p.tolerate(err) {
+			return nil, err
+		}
+		args = append(args[:1], args[len(args)-1])
+	}
+	term := args[len(args)-1]
+	if len(term) == 0 {
+		if err := t.errorf(KindMissingOperand, "missing argument to %s", string(t.val)); !p.tolerate(err) {
+			return nil, err
+		}
+		term = []Node{placeholder()}
 	}
 
-	out.postProcess()
-	switch len(out.terms) {
-	case 1:
-		return out.terms[0], nil
-	case 0:
+	out := &Root{Term: seqNode(term)}
+	if len(args) == 2 {
+		out.Index = seqNode(args[0])
+	}
+	return out, nil
+}
+
+// parse parses the whole equation.
+func (p *asciiParser) parse() (Node, error) {
+	if p.peek().kind == tokEOF {
 		return nil, nil
-	default:
-		return &Run{Terms: out.terms}, nil
 	}
+	out, err := p.parseRelation()
+	if err != nil {
+		return nil, err
+	}
+
+	// Only unmatched end parentheses can follow a complete equation.
+	// Tolerant parsers skip them, and parse the input after them.
+	for t := p.peek(); t.kind != tokEOF; t = p.peek() {
+		if err := t.errorf(KindUnmatched, "unmatched end parenthesis"); !p.tolerate(err) {
+			return nil, err
+		}
+		p.next()
+		if k := p.peek().kind; k == tokEOF || k == tokClose {
+			continue
+		}
+		rest, err := p.parseRelation()
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, rest...)
+	}
+	return seqNode(out), nil
+}
+
+// ParseASCIIEquation attempts to generate the node tree by parsing an
+// ascii representation of the equation.
+func ParseASCIIEquation(inp string) (Node, error) {
+	toks, err := lexASCII(inp)
+	if err != nil {
+		err.locate(inp)
+		return nil, err
+	}
+	p := asciiParser{toks: toks}
+	n, perr := p.parse()
+	return n, locateError(perr, inp)
+}
+
+// ParseASCIIEquationTolerant parses an ascii representation of the equation
+// like ParseASCIIEquation, but recovers from errors so a tree can be drawn
+// for incomplete input, such as while the equation is being typed. Open
+// parentheses are closed at the end of the input, unmatched end parentheses
+// are skipped, and missing operands are replaced with a Placeholder term,
+// so 1/ is parsed as 1/□. The errors recovered from are returned in the
+// order they occur in the input.
+func ParseASCIIEquationTolerant(inp string) (Node, []*ParseError) {
+	toks, err := lexASCII(inp)
+	p := asciiParser{toks: toks, tolerant: true}
+	n, _ := p.parse()
+	if err != nil {
+		p.diags = append(p.diags, err)
+	}
+	// Unmatched start parentheses are only found after their contents.
+	sort.SliceStable(p.diags, func(i, j int) bool { return p.diags[i].Offset < p.diags[j].Offset })
+	for _, d := range p.diags {
+		d.locate(inp)
+	}
+	return n, p.diags
 }
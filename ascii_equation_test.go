@@ -1,8 +1,11 @@
 package eqdraw
 
 import (
+	"math/rand"
+	"strings"
 	"testing"
 
+	"github.com/golang/freetype/truetype"
 	"github.com/google/go-cmp/cmp"
 )
 
@@ -10,13 +13,13 @@ func TestAsciiEquation(t *testing.T) {
 	tcs := []struct {
 		name     string
 		input    string
-		expected node
-		err      error
+		expected Node
+		err      *ParseError
 	}{
 		{
 			name:  "basic nospace",
 			input: "1+2",
-			expected: &Run{Terms: []node{
+			expected: &Run{Terms: []Node{
 				&Term{Content: []rune{'1'}},
 				&Term{Content: []rune{'+'}},
 				&Term{Content: []rune{'2'}},
@@ -25,7 +28,7 @@ func TestAsciiEquation(t *testing.T) {
 		{
 			name:  "basic space",
 			input: "1 + 2",
-			expected: &Run{Terms: []node{
+			expected: &Run{Terms: []Node{
 				&Term{Content: []rune{'1'}},
 				&Term{Content: []rune{'+'}},
 				&Term{Content: []rune{'2'}},
@@ -34,10 +37,10 @@ func TestAsciiEquation(t *testing.T) {
 		{
 			name:  "basic parenthesis nospace",
 			input: "2(b+1)",
-			expected: &Run{Terms: []node{
+			expected: &Run{Terms: []Node{
 				&Term{Content: []rune{'2'}},
 				&Parenthesis{Term: &Run{
-					Terms: []node{
+					Terms: []Node{
 						&Term{Content: []rune{'b'}},
 						&Term{Content: []rune{'+'}},
 						&Term{Content: []rune{'1'}},
@@ -48,10 +51,10 @@ func TestAsciiEquation(t *testing.T) {
 		{
 			name:  "basic parenthesis",
 			input: "2(b + 1 )",
-			expected: &Run{Terms: []node{
+			expected: &Run{Terms: []Node{
 				&Term{Content: []rune{'2'}},
 				&Parenthesis{Term: &Run{
-					Terms: []node{
+					Terms: []Node{
 						&Term{Content: []rune{'b'}},
 						&Term{Content: []rune{'+'}},
 						&Term{Content: []rune{'1'}},
@@ -62,7 +65,7 @@ func TestAsciiEquation(t *testing.T) {
 		{
 			name:  "parenthesis superfluous",
 			input: "2(1)",
-			expected: &Run{Terms: []node{
+			expected: &Run{Terms: []Node{
 				&Term{Content: []rune{'2'}},
 				&Parenthesis{
 					Term: &Term{Content: []rune{'1'}},
@@ -72,7 +75,7 @@ func TestAsciiEquation(t *testing.T) {
 		{
 			name:  "line",
 			input: "y = mx + b",
-			expected: &Run{Terms: []node{
+			expected: &Run{Terms: []Node{
 				&Term{Content: []rune{'y'}},
 				&Term{Content: []rune{'='}},
 				&Term{Content: []rune{'m', 'x'}},
@@ -83,12 +86,67 @@ func TestAsciiEquation(t *testing.T) {
 		{
 			name:  "sqrt",
 			input: "sqrt(12 - a)",
-			expected: &Root{Term: &Run{Terms: []node{
+			expected: &Root{Term: &Run{Terms: []Node{
 				&Term{Content: []rune{'1', '2'}},
 				&Term{Content: []rune{'-'}},
 				&Term{Content: []rune{'a'}},
 			}}},
 		},
+		{
+			name:  "nth root",
+			input: "root(n+1, x) - root(, 2)",
+			expected: &Run{Terms: []Node{
+				&Root{
+					Index: &Run{Terms: []Node{
+						&Term{Content: []rune{'n'}},
+						&Term{Content: []rune{'+'}},
+						&Term{Content: []rune{'1'}},
+					}},
+					Term: &Term{Content: []rune{'x'}},
+				},
+				&Term{Content: []rune{'-'}},
+				&Root{Term: &Term{Content: []rune{'2'}}},
+			}},
+		},
+		{
+			name:  "cube root",
+			input: "2∛x^2 + ∜(a+b)",
+			expected: &Run{Terms: []Node{
+				&Term{Content: []rune{'2'}},
+				&Sup{
+					Base:     &Root{Index: &Term{Content: []rune{'3'}}, Term: &Term{Content: []rune{'x'}}},
+					Exponent: &Term{Content: []rune{'2'}},
+				},
+				&Term{Content: []rune{'+'}},
+				&Root{Index: &Term{Content: []rune{'4'}}, Term: &Parenthesis{Term: &Run{Terms: []Node{
+					&Term{Content: []rune{'a'}},
+					&Term{Content: []rune{'+'}},
+					&Term{Content: []rune{'b'}},
+				}}}},
+			}},
+		},
+		{
+			name:  "signed scripts",
+			input: "e^-x + a_+n^-2^-1",
+			expected: &Run{Terms: []Node{
+				&Sup{
+					Base:     &Term{Content: []rune{'e'}},
+					Exponent: &Run{Terms: []Node{&Term{Content: []rune{'-'}}, &Term{Content: []rune{'x'}}}},
+				},
+				&Term{Content: []rune{'+'}},
+				&Sub{
+					Base:  &Term{Content: []rune{'a'}},
+					Index: &Run{Terms: []Node{&Term{Content: []rune{'+'}}, &Term{Content: []rune{'n'}}}},
+					Exponent: &Run{Terms: []Node{
+						&Term{Content: []rune{'-'}},
+						&Sup{
+							Base:     &Term{Content: []rune{'2'}},
+							Exponent: &Run{Terms: []Node{&Term{Content: []rune{'-'}}, &Term{Content: []rune{'1'}}}},
+						},
+					}},
+				},
+			}},
+		},
 		{
 			name:  "div",
 			input: "1/2",
@@ -101,38 +159,812 @@ func TestAsciiEquation(t *testing.T) {
 			name:  "div unwrap",
 			input: "(1 + 2)/(2+1)",
 			expected: &Div{
-				Numerator:   &Run{Terms: []node{&Term{Content: []rune{'1'}}, &Term{Content: []rune{'+'}}, &Term{Content: []rune{'2'}}}},
-				Denominator: &Run{Terms: []node{&Term{Content: []rune{'2'}}, &Term{Content: []rune{'+'}}, &Term{Content: []rune{'1'}}}},
+				Numerator:   &Run{Terms: []Node{&Term{Content: []rune{'1'}}, &Term{Content: []rune{'+'}}, &Term{Content: []rune{'2'}}}},
+				Denominator: &Run{Terms: []Node{&Term{Content: []rune{'2'}}, &Term{Content: []rune{'+'}}, &Term{Content: []rune{'1'}}}},
 			},
 		},
 		{
 			name:  "eq with div",
 			input: "2x = 1/2",
-			expected: &Run{Terms: []node{&Term{Content: []rune{'2', 'x'}}, &Term{Content: []rune{'='}}, &Div{
+			expected: &Run{Terms: []Node{&Term{Content: []rune{'2', 'x'}}, &Term{Content: []rune{'='}}, &Div{
 				Numerator:   &Term{Content: []rune{'1'}},
 				Denominator: &Term{Content: []rune{'2'}},
 			}}},
 		},
 		{
-			name:  "eq with div stack overflow",
+			name:  "eq with div precedence",
 			input: "y = mx + b/2",
-			expected: &Run{Terms: []node{&Term{Content: []rune{'y'}}, &Term{Content: []rune{'='}}, &Div{
-				Numerator:   &Run{Terms: []node{&Term{Content: []rune{'m', 'x'}}, &Term{Content: []rune{'+'}}, &Term{Content: []rune{'b'}}}},
+			expected: &Run{Terms: []Node{
+				&Term{Content: []rune{'y'}},
+				&Term{Content: []rune{'='}},
+				&Term{Content: []rune{'m', 'x'}},
+				&Term{Content: []rune{'+'}},
+				&Div{
+					Numerator:   &Term{Content: []rune{'b'}},
+					Denominator: &Term{Content: []rune{'2'}},
+				},
+			}},
+		},
+		{
+			name:  "div sum",
+			input: "a/b + c/d",
+			expected: &Run{Terms: []Node{
+				&Div{
+					Numerator:   &Term{Content: []rune{'a'}},
+					Denominator: &Term{Content: []rune{'b'}},
+				},
+				&Term{Content: []rune{'+'}},
+				&Div{
+					Numerator:   &Term{Content: []rune{'c'}},
+					Denominator: &Term{Content: []rune{'d'}},
+				},
+			}},
+		},
+		{
+			name:  "div chained",
+			input: "a/b/c",
+			expected: &Div{
+				Numerator: &Div{
+					Numerator:   &Term{Content: []rune{'a'}},
+					Denominator: &Term{Content: []rune{'b'}},
+				},
+				Denominator: &Term{Content: []rune{'c'}},
+			},
+		},
+		{
+			name:  "div binds before mul",
+			input: "2*a/b",
+			expected: &Run{Terms: []Node{
+				&Term{Content: []rune{'2'}},
+				&Term{Content: []rune{'*'}},
+				&Div{
+					Numerator:   &Term{Content: []rune{'a'}},
+					Denominator: &Term{Content: []rune{'b'}},
+				},
+			}},
+		},
+		{
+			name:  "div signed",
+			input: "-1/-x",
+			expected: &Run{Terms: []Node{
+				&Term{Content: []rune{'-'}},
+				&Div{
+					Numerator:   &Term{Content: []rune{'1'}},
+					Denominator: &Run{Terms: []Node{&Term{Content: []rune{'-'}}, &Term{Content: []rune{'x'}}}},
+				},
+			}},
+		},
+		{
+			name:  "eq nospace",
+			input: "y=1/(x+1)",
+			expected: &Run{Terms: []Node{
+				&Term{Content: []rune{'y'}},
+				&Term{Content: []rune{'='}},
+				&Div{
+					Numerator:   &Term{Content: []rune{'1'}},
+					Denominator: &Run{Terms: []Node{&Term{Content: []rune{'x'}}, &Term{Content: []rune{'+'}}, &Term{Content: []rune{'1'}}}},
+				},
+			}},
+		},
+		{
+			name:  "quoted",
+			input: "'a+b' = c",
+			expected: &Run{Terms: []Node{
+				&Term{Content: []rune{'a', '+', 'b'}},
+				&Term{Content: []rune{'='}},
+				&Term{Content: []rune{'c'}},
+			}},
+		},
+		{
+			name:  "unmatched end parenthesis",
+			input: "1 + 2)",
+			err:   &ParseError{Pos: 6, Offset: 5, Line: 1, Column: 6, Len: 1, Kind: KindUnmatched, Msg: "unmatched end parenthesis"},
+		},
+		{
+			name:  "unmatched start parenthesis",
+			input: "2(1 + 2",
+			err:   &ParseError{Pos: 2, Offset: 1, Line: 1, Column: 2, Len: 1, Kind: KindUnmatched, Msg: "unmatched start parenthesis"},
+		},
+		{
+			name:  "missing operand",
+			input: "1/",
+			err:   &ParseError{Pos: 2, Offset: 1, Line: 1, Column: 2, Len: 1, Kind: KindMissingOperand, Msg: `missing operand after "/"`},
+		},
+		{
+			name:  "missing operand in parenthesis",
+			input: "(1 +)",
+			err:   &ParseError{Pos: 4, Offset: 3, Line: 1, Column: 4, Len: 1, Kind: KindMissingOperand, Msg: `missing operand after "+"`},
+		},
+		{
+			name:  "unmatched function",
+			input: "π = sqrt(x",
+			err:   &ParseError{Pos: 5, Offset: 5, Line: 1, Column: 5, Len: 5, Kind: KindUnmatched, Msg: "unmatched start parenthesis"},
+		},
+		{
+			name:  "too many root arguments",
+			input: "root(3, x, y)",
+			err:   &ParseError{Pos: 1, Offset: 0, Line: 1, Column: 1, Len: 5, Kind: KindUnexpected, Msg: "too many arguments to root"},
+		},
+		{
+			name:  "missing radicand",
+			input: "1 + ∛",
+			err:   &ParseError{Pos: 5, Offset: 4, Line: 1, Column: 5, Len: 1, Kind: KindMissingOperand, Msg: `missing operand after "∛"`},
+		},
+		{
+			name:  "unterminated quote",
+			input: "a + 'bc",
+			err:   &ParseError{Pos: 5, Offset: 4, Line: 1, Column: 5, Len: 3, Kind: KindUnmatched, Msg: "unterminated quote"},
+		},
+		{
+			name:  "unexpected",
+			input: "2 + * x",
+			err:   &ParseError{Pos: 5, Offset: 4, Line: 1, Column: 5, Len: 1, Kind: KindUnexpected, Msg: `unexpected "*"`},
+		},
+		{
+			name:  "empty big operator body",
+			input: "sum(i=1, n, )",
+			err:   &ParseError{Pos: 1, Offset: 0, Line: 1, Column: 1, Len: 4, Kind: KindMissingOperand, Msg: "missing argument to sum"},
+		},
+		{
+			name:  "too many big operator arguments",
+			input: "prod(a, b, c, d)",
+			err:   &ParseError{Pos: 1, Offset: 0, Line: 1, Column: 1, Len: 5, Kind: KindUnexpected, Msg: "too many arguments to prod"},
+		},
+		{
+			name:  "unmatched matrix",
+			input: "[[a, b], [c",
+			err:   &ParseError{Pos: 10, Offset: 9, Line: 1, Column: 10, Len: 1, Kind: KindUnmatched, Msg: "unmatched start bracket"},
+		},
+		{
+			name:  "missing row",
+			input: "[[a], ]",
+			err:   &ParseError{Pos: 7, Offset: 6, Line: 1, Column: 7, Len: 1, Kind: KindMissingOperand, Msg: `missing row after ","`},
+		},
+		{
+			name:  "unmatched end parenthesis in matrix",
+			input: "[[a)]]",
+			err:   &ParseError{Pos: 4, Offset: 3, Line: 1, Column: 4, Len: 1, Kind: KindUnmatched, Msg: "unmatched end parenthesis"},
+		},
+		{
+			name:  "missing operand before comma",
+			input: "sum(i=, n, i)",
+			err:   &ParseError{Pos: 6, Offset: 5, Line: 1, Column: 6, Len: 1, Kind: KindMissingOperand, Msg: `missing operand after "="`},
+		},
+		{
+			name:  "sup",
+			input: "x^2",
+			expected: &Sup{
+				Base:     &Term{Content: []rune{'x'}},
+				Exponent: &Term{Content: []rune{'2'}},
+			},
+		},
+		{
+			name:  "sup grouped",
+			input: "e^(i*pi)",
+			expected: &Sup{
+				Base:     &Term{Content: []rune{'e'}},
+				Exponent: &Run{Terms: []Node{&Term{Content: []rune{'i'}}, &Term{Content: []rune{'*'}}, &Term{Content: []rune{'p', 'i'}}}},
+			},
+		},
+		{
+			name:  "sup right associative",
+			input: "a^b^c",
+			expected: &Sup{
+				Base: &Term{Content: []rune{'a'}},
+				Exponent: &Sup{
+					Base:     &Term{Content: []rune{'b'}},
+					Exponent: &Term{Content: []rune{'c'}},
+				},
+			},
+		},
+		{
+			name:  "sup binds before mul",
+			input: "2*x^2",
+			expected: &Run{Terms: []Node{
+				&Term{Content: []rune{'2'}},
+				&Term{Content: []rune{'*'}},
+				&Sup{
+					Base:     &Term{Content: []rune{'x'}},
+					Exponent: &Term{Content: []rune{'2'}},
+				},
+			}},
+		},
+		{
+			name:  "sup binds before div",
+			input: "x^2/3",
+			expected: &Div{
+				Numerator: &Sup{
+					Base:     &Term{Content: []rune{'x'}},
+					Exponent: &Term{Content: []rune{'2'}},
+				},
+				Denominator: &Term{Content: []rune{'3'}},
+			},
+		},
+		{
+			name:  "sub",
+			input: "x_i",
+			expected: &Sub{
+				Base:  &Term{Content: []rune{'x'}},
+				Index: &Term{Content: []rune{'i'}},
+			},
+		},
+		{
+			name:  "sub grouped",
+			input: "a_(n+1)",
+			expected: &Sub{
+				Base:  &Term{Content: []rune{'a'}},
+				Index: &Run{Terms: []Node{&Term{Content: []rune{'n'}}, &Term{Content: []rune{'+'}}, &Term{Content: []rune{'1'}}}},
+			},
+		},
+		{
+			name:  "sub and sup",
+			input: "x_i^2 + x^2_j",
+			expected: &Run{Terms: []Node{
+				&Sub{
+					Base:     &Term{Content: []rune{'x'}},
+					Index:    &Term{Content: []rune{'i'}},
+					Exponent: &Term{Content: []rune{'2'}},
+				},
+				&Term{Content: []rune{'+'}},
+				&Sub{
+					Base:     &Term{Content: []rune{'x'}},
+					Index:    &Term{Content: []rune{'j'}},
+					Exponent: &Term{Content: []rune{'2'}},
+				},
+			}},
+		},
+		{
+			name:  "sum",
+			input: "sum(i=1, n, i^2)",
+			expected: &BigOp{
+				Op:    OpSum,
+				Lower: &Run{Terms: []Node{&Term{Content: []rune{'i'}}, &Term{Content: []rune{'='}}, &Term{Content: []rune{'1'}}}},
+				Upper: &Term{Content: []rune{'n'}},
+				Body: &Sup{
+					Base:     &Term{Content: []rune{'i'}},
+					Exponent: &Term{Content: []rune{'2'}},
+				},
+			},
+		},
+		{
+			name:  "integral",
+			input: "int(0, 1, f(x) dx)",
+			expected: &BigOp{
+				Op:    OpIntegral,
+				Lower: &Term{Content: []rune{'0'}},
+				Upper: &Term{Content: []rune{'1'}},
+				Body: &Run{Terms: []Node{
+					&Term{Content: []rune{'f'}},
+					&Parenthesis{Term: &Term{Content: []rune{'x'}}},
+					&Term{Content: []rune("dx")},
+				}},
+			},
+		},
+		{
+			name:  "big operator lower limit",
+			input: "prod(k, (a, b))",
+			expected: &BigOp{
+				Op:    OpProduct,
+				Lower: &Term{Content: []rune{'k'}},
+				Body: &Parenthesis{Term: &Run{Terms: []Node{
+					&Term{Content: []rune{'a'}},
+					&Term{Content: []rune{'b'}},
+				}}},
+			},
+		},
+		{
+			name:  "big operator without limits",
+			input: "2 oint(E dA)",
+			expected: &Run{Terms: []Node{
+				&Term{Content: []rune{'2'}},
+				&BigOp{Op: OpContourIntegral, Body: &Run{Terms: []Node{
+					&Term{Content: []rune{'E'}},
+					&Term{Content: []rune("dA")},
+				}}},
+			}},
+		},
+		{
+			name:  "matrix",
+			input: "A = [[1, -x], [(y, z), ]]",
+			expected: &Run{Terms: []Node{
+				&Term{Content: []rune{'A'}},
+				&Term{Content: []rune{'='}},
+				&Matrix{
+					Rows: [][]Node{
+						{
+							&Term{Content: []rune{'1'}},
+							&Run{Terms: []Node{&Term{Content: []rune{'-'}}, &Term{Content: []rune{'x'}}}},
+						},
+						{
+							&Parenthesis{Term: &Run{Terms: []Node{&Term{Content: []rune{'y'}}, &Term{Content: []rune{'z'}}}}},
+							nil,
+						},
+					},
+					Delims: DelimBrackets,
+				},
+			}},
+		},
+		{
+			name:  "column vector",
+			input: "[[x],[y^2]]_i [a]",
+			expected: &Run{Terms: []Node{
+				&Sub{
+					Base: &Matrix{
+						Rows: [][]Node{
+							{&Term{Content: []rune{'x'}}},
+							{&Sup{Base: &Term{Content: []rune{'y'}}, Exponent: &Term{Content: []rune{'2'}}}},
+						},
+						Delims: DelimBrackets,
+					},
+					Index: &Term{Content: []rune{'i'}},
+				},
+				&Term{Content: []rune("[a]")},
+			}},
+		},
+		{
+			name:  "big operator empty limit",
+			input: "sum(, n, x)/2",
+			expected: &Div{
+				Numerator:   &BigOp{Op: OpSum, Upper: &Term{Content: []rune{'n'}}, Body: &Term{Content: []rune{'x'}}},
 				Denominator: &Term{Content: []rune{'2'}},
-			}}},
+			},
 		},
 	}
 
 	for _, tc := range tcs {
 		t.Run(tc.name, func(t *testing.T) {
 			out, err := ParseASCIIEquation(tc.input)
-			if err != tc.err {
-				t.Errorf("err = %v, want %v", err, tc.err)
+			if tc.err != nil {
+				if diff := cmp.Diff(err, error(tc.err)); diff != "" {
+					t.Errorf("err differed:\n%s", diff)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseASCIIEquation() failed: %v", err)
+			}
+			if diff := cmp.Diff(out, tc.expected); diff != "" {
+				t.Errorf("output differed:\n%s", diff)
 			}
-			if diff := cmp.Diff(out, tc.expected,
-				cmp.AllowUnexported(Run{}), cmp.AllowUnexported(Term{}), cmp.AllowUnexported(Parenthesis{}), cmp.AllowUnexported(Root{}), cmp.AllowUnexported(Div{})); diff != "" {
+		})
+	}
+}
+
+func TestFormatASCII(t *testing.T) {
+	tcs := []struct {
+		input    string
+		expected string
+	}{
+		{input: "1+2", expected: "1 + 2"},
+		{input: "2(b+1)", expected: "2(b + 1)"},
+		{input: "y = mx + b", expected: "y = mx + b"},
+		{input: "sqrt(12 - a)", expected: "sqrt(12 - a)"},
+		{input: "sqrt (x)", expected: "sqrt (x)"},
+		{input: "(1 + 2)/(2+1)", expected: "(1 + 2)/(2 + 1)"},
+		{input: "a/b/c", expected: "a/b/c"},
+		{input: "a/(b/c)", expected: "a/(b/c)"},
+		{input: "((a))/b", expected: "((a))/b"},
+		{input: "()/b", expected: "()/b"},
+		{input: "2*a/b", expected: "2 * a/b"},
+		{input: "-1/-x", expected: "-1/-x"},
+		{input: "1/-(x+1)", expected: "1/-(x + 1)"},
+		{input: "a - -b", expected: "a - -b"},
+		{input: "'a+b' = c", expected: "'a+b' = c"},
+		{input: "'+' - '='", expected: "'+' - '='"},
+		{input: "e^(i*pi)", expected: "e^(i * pi)"},
+		{input: "a^b^c", expected: "a^b^c"},
+		{input: "(a^b)^c", expected: "(a^b)^c"},
+		{input: "(x+1)^2", expected: "(x + 1)^2"},
+		{input: "x^((y))", expected: "x^((y))"},
+		{input: "x^2/3", expected: "x^2/3"},
+		{input: "a_(n+1)", expected: "a_(n + 1)"},
+		{input: "x_i^2 + x^2_j", expected: "x_i^2 + x_j^2"},
+		{input: "x_(i_j)", expected: "x_(i_j)"},
+		{input: "x^-1 + e^(-x)", expected: "x^-1 + e^-x"},
+		{input: "a_-i^-(b+1)/2", expected: "a_-i^-(b + 1)/2"},
+		{input: "x_(-i)^(+2)", expected: "x_-i^+2"},
+		{input: "sqrt(x)^2", expected: "sqrt(x)^2"},
+		{input: "root(3,x+1)/2", expected: "root(3, x + 1)/2"},
+		{input: "root(, x)", expected: "sqrt(x)"},
+		{input: "∛x^3", expected: "root(3, x)^3"},
+		{input: "'a∛b' + '∜'", expected: "'a∛b' + '∜'"},
+		{input: "sum(i=1,n,i)", expected: "sum(i = 1, n, i)"},
+		{input: "int(, 1, x) + coprod(x)", expected: "int(, 1, x) + coprod(x)"},
+		{input: "prod(k, 1/k)^2", expected: "prod(k, 1/k)^2"},
+		{input: "sum (x)", expected: "sum (x)"},
+		{input: "[[a,b],[c, d+1]]/2", expected: "[[a, b], [c, d + 1]]/2"},
+		{input: "[[], [x, ]]", expected: "[[], [x, ]]"},
+		{input: "[[ [[a]] ]]^T", expected: "[[[[a]]]]^T"},
+		{input: "f[x]", expected: "'f[x]'"},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.input, func(t *testing.T) {
+			n, err := ParseASCIIEquation(tc.input)
+			if err != nil {
+				t.Fatalf("ParseASCIIEquation(%q) failed: %v", tc.input, err)
+			}
+			out, err := FormatASCII(n)
+			if err != nil {
+				t.Fatalf("FormatASCII() failed: %v", err)
+			}
+			if out != tc.expected {
+				t.Errorf("FormatASCII() = %q, want %q", out, tc.expected)
+			}
+
+			reparsed, err := ParseASCIIEquation(out)
+			if err != nil {
+				t.Fatalf("ParseASCIIEquation(%q) failed: %v", out, err)
+			}
+			if diff := cmp.Diff(reparsed, n); diff != "" {
+				t.Errorf("round trip differed:\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestFormatASCIITrees(t *testing.T) {
+	tcs := []struct {
+		name     string
+		node     Node
+		expected string
+		err      bool
+	}{
+		{
+			name:     "nil",
+			expected: "",
+		},
+		{
+			name:     "styled term",
+			node:     &Term{Content: []rune("x"), Style: StyleBold},
+			expected: "x",
+		},
+		{
+			name:     "term with space",
+			node:     &Term{Content: []rune("if x")},
+			expected: "'if x'",
+		},
+		{
+			name: "trailing operator",
+			node: &Run{Terms: []Node{
+				&Term{Content: []rune("a")},
+				&Term{Content: []rune("+")},
+			}},
+			expected: "a '+'",
+		},
+		{
+			name: "run as base",
+			node: &Sup{
+				Base:     &Run{Terms: []Node{&Term{Content: []rune("a")}, &Term{Content: []rune("b")}}},
+				Exponent: &Term{Content: []rune("2")},
+			},
+			expected: "(a b)^2",
+		},
+		{
+			name:     "big operator upper limit",
+			node:     &BigOp{Op: OpSum, Upper: &Term{Content: []rune("n")}, Body: &Term{Content: []rune("x")}},
+			expected: "sum(, n, x)",
+		},
+		{
+			name: "big operator without body",
+			node: &BigOp{Op: OpSum},
+			err:  true,
+		},
+		{
+			name: "unknown big operator",
+			node: &BigOp{Op: '⋃', Body: &Term{Content: []rune("A")}},
+			err:  true,
+		},
+		{
+			name: "matrix",
+			node: &Matrix{
+				Rows:   [][]Node{{&Term{Content: []rune("a")}, &Term{Content: []rune("b")}}, {&Term{Content: []rune("c")}}},
+				Align:  []Alignment{AlignLeft},
+				Delims: DelimBars,
+			},
+			expected: "[[a, b], [c]]",
+		},
+		{
+			name:     "empty matrix",
+			node:     &Matrix{},
+			expected: "[[]]",
+		},
+		{
+			name: "term with quote",
+			node: &Term{Content: []rune("f'")},
+			err:  true,
+		},
+		{
+			name: "custom node",
+			node: &Run{Terms: []Node{&Term{Content: []rune("a")}, &boxNode{}}},
+			err:  true,
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			out, err := FormatASCII(tc.node)
+			if tc.err {
+				if err == nil {
+					t.Errorf("FormatASCII() = %q, want error", out)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("FormatASCII() failed: %v", err)
+			}
+			if out != tc.expected {
+				t.Errorf("FormatASCII() = %q, want %q", out, tc.expected)
+			}
+		})
+	}
+}
+
+func TestFormatASCIIRandom(t *testing.T) {
+	tokens := []string{"a", "2", "xy", "+", "-", "*", "=", "/", "^", "_", "(", ")", "sqrt(", "sum(", "root(", "∛", ",", "[[", "[", "]", " ", "'b c'", "'∛a'"}
+	rng := rand.New(rand.NewSource(1))
+
+	for i := 0; i < 20000; i++ {
+		var b strings.Builder
+		for j := rng.Intn(12); j >= 0; j-- {
+			b.WriteString(tokens[rng.Intn(len(tokens))])
+		}
+		input := b.String()
+		n, err := ParseASCIIEquation(input)
+		if err != nil {
+			continue
+		}
+		out, err := FormatASCII(n)
+		if err != nil {
+			t.Fatalf("FormatASCII(%q) failed: %v", input, err)
+		}
+		reparsed, err := ParseASCIIEquation(out)
+		if err != nil {
+			t.Fatalf("ParseASCIIEquation(%q) failed: %v (formatted from %q)", out, err, input)
+		}
+		if diff := cmp.Diff(reparsed, n); diff != "" {
+			t.Fatalf("round trip of %q through %q differed:\n%s", input, out, diff)
+		}
+	}
+}
+
+func TestAsciiEquationTolerant(t *testing.T) {
+	ph := &Term{Content: []rune{Placeholder}}
+	tcs := []struct {
+		name     string
+		input    string
+		expected Node
+		diags    []*ParseError
+	}{
+		{
+			name:  "valid",
+			input: "x^2 + 1",
+			expected: &Run{Terms: []Node{
+				&Sup{Base: &Term{Content: []rune("x")}, Exponent: &Term{Content: []rune("2")}},
+				&Term{Content: []rune("+")},
+				&Term{Content: []rune("1")},
+			}},
+		},
+		{
+			name:  "empty",
+			input: " ",
+		},
+		{
+			name:     "missing denominator",
+			input:    "1/",
+			expected: &Div{Numerator: &Term{Content: []rune("1")}, Denominator: ph},
+			diags: []*ParseError{
+				{Pos: 2, Offset: 1, Line: 1, Column: 2, Len: 1, Kind: KindMissingOperand, Msg: `missing operand after "/"`},
+			},
+		},
+		{
+			name:  "unclosed parentheses",
+			input: "2((x + ",
+			expected: &Run{Terms: []Node{
+				&Term{Content: []rune("2")},
+				&Parenthesis{Term: &Parenthesis{Term: &Run{Terms: []Node{
+					&Term{Content: []rune("x")},
+					&Term{Content: []rune("+")},
+					ph,
+				}}}},
+			}},
+			diags: []*ParseError{
+				{Pos: 2, Offset: 1, Line: 1, Column: 2, Len: 1, Kind: KindUnmatched, Msg: "unmatched start parenthesis"},
+				{Pos: 3, Offset: 2, Line: 1, Column: 3, Len: 1, Kind: KindUnmatched, Msg: "unmatched start parenthesis"},
+				{Pos: 6, Offset: 5, Line: 1, Column: 6, Len: 1, Kind: KindMissingOperand, Msg: `missing operand after "+"`},
+			},
+		},
+		{
+			name:     "empty sqrt",
+			input:    "sqrt(",
+			expected: &Root{Term: ph},
+			diags: []*ParseError{
+				{Pos: 1, Offset: 0, Line: 1, Column: 1, Len: 5, Kind: KindUnmatched, Msg: "unmatched start parenthesis"},
+				{Pos: 1, Offset: 0, Line: 1, Column: 1, Len: 5, Kind: KindMissingOperand, Msg: "missing argument to sqrt"},
+			},
+		},
+		{
+			name:     "empty root",
+			input:    "root(3, )",
+			expected: &Root{Index: &Term{Content: []rune("3")}, Term: ph},
+			diags: []*ParseError{
+				{Pos: 1, Offset: 0, Line: 1, Column: 1, Len: 5, Kind: KindMissingOperand, Msg: "missing argument to root"},
+			},
+		},
+		{
+			name:     "empty big operator",
+			input:    "sum(i, ",
+			expected: &BigOp{Op: OpSum, Lower: &Term{Content: []rune("i")}, Body: ph},
+			diags: []*ParseError{
+				{Pos: 1, Offset: 0, Line: 1, Column: 1, Len: 4, Kind: KindUnmatched, Msg: "unmatched start parenthesis"},
+				{Pos: 1, Offset: 0, Line: 1, Column: 1, Len: 4, Kind: KindMissingOperand, Msg: "missing argument to sum"},
+			},
+		},
+		{
+			name:  "too many big operator arguments",
+			input: "int(a, b, c, d)",
+			expected: &BigOp{
+				Op:    OpIntegral,
+				Lower: &Term{Content: []rune("a")},
+				Upper: &Term{Content: []rune("b")},
+				Body:  &Term{Content: []rune("d")},
+			},
+			diags: []*ParseError{
+				{Pos: 1, Offset: 0, Line: 1, Column: 1, Len: 4, Kind: KindUnexpected, Msg: "too many arguments to int"},
+			},
+		},
+		{
+			name:  "unclosed matrix",
+			input: "[[a, b], [c +",
+			expected: &Matrix{
+				Rows: [][]Node{
+					{&Term{Content: []rune("a")}, &Term{Content: []rune("b")}},
+					{&Run{Terms: []Node{&Term{Content: []rune("c")}, &Term{Content: []rune("+")}, ph}}},
+				},
+				Delims: DelimBrackets,
+			},
+			diags: []*ParseError{
+				{Pos: 1, Offset: 0, Line: 1, Column: 1, Len: 1, Kind: KindUnmatched, Msg: "unmatched start bracket"},
+				{Pos: 10, Offset: 9, Line: 1, Column: 10, Len: 1, Kind: KindUnmatched, Msg: "unmatched start bracket"},
+				{Pos: 13, Offset: 12, Line: 1, Column: 13, Len: 1, Kind: KindMissingOperand, Msg: `missing operand after "+"`},
+			},
+		},
+		{
+			name:  "matrix missing comma",
+			input: "[[a] [b]]",
+			expected: &Matrix{
+				Rows:   [][]Node{{&Term{Content: []rune("a")}}, {&Term{Content: []rune("b")}}},
+				Delims: DelimBrackets,
+			},
+			diags: []*ParseError{
+				{Pos: 6, Offset: 5, Line: 1, Column: 6, Len: 1, Kind: KindUnexpected, Msg: `unexpected "["`},
+			},
+		},
+		{
+			name:  "unmatched end parenthesis",
+			input: "a) + b",
+			expected: &Run{Terms: []Node{
+				&Term{Content: []rune("a")},
+				&Term{Content: []rune("+")},
+				&Term{Content: []rune("b")},
+			}},
+			diags: []*ParseError{
+				{Pos: 2, Offset: 1, Line: 1, Column: 2, Len: 1, Kind: KindUnmatched, Msg: "unmatched end parenthesis"},
+			},
+		},
+		{
+			name:  "missing operand before operator",
+			input: "= x",
+			expected: &Run{Terms: []Node{
+				ph,
+				&Term{Content: []rune("=")},
+				&Term{Content: []rune("x")},
+			}},
+			diags: []*ParseError{
+				{Pos: 1, Offset: 0, Line: 1, Column: 1, Len: 1, Kind: KindUnexpected, Msg: `unexpected "="`},
+			},
+		},
+		{
+			name:  "multiple indices",
+			input: "x_i_j",
+			expected: &Sub{
+				Base:  &Sub{Base: &Term{Content: []rune("x")}, Index: &Term{Content: []rune("i")}},
+				Index: &Term{Content: []rune("j")},
+			},
+			diags: []*ParseError{
+				{Pos: 4, Offset: 3, Line: 1, Column: 4, Len: 1, Kind: KindUnexpected, Msg: "multiple indices"},
+			},
+		},
+		{
+			name:     "stray end parentheses",
+			input:    "))a",
+			expected: &Run{Terms: []Node{ph, &Term{Content: []rune("a")}}},
+			diags: []*ParseError{
+				{Pos: 1, Offset: 0, Line: 1, Column: 1, Len: 1, Kind: KindUnmatched, Msg: "unmatched end parenthesis"},
+				{Pos: 2, Offset: 1, Line: 1, Column: 2, Len: 1, Kind: KindUnmatched, Msg: "unmatched end parenthesis"},
+			},
+		},
+		{
+			name:  "unterminated quote",
+			input: "(a + 'b c",
+			expected: &Parenthesis{Term: &Run{Terms: []Node{
+				&Term{Content: []rune("a")},
+				&Term{Content: []rune("+")},
+				&Term{Content: []rune("b c")},
+			}}},
+			diags: []*ParseError{
+				{Pos: 1, Offset: 0, Line: 1, Column: 1, Len: 1, Kind: KindUnmatched, Msg: "unmatched start parenthesis"},
+				{Pos: 6, Offset: 5, Line: 1, Column: 6, Len: 4, Kind: KindUnmatched, Msg: "unterminated quote"},
+			},
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			out, diags := ParseASCIIEquationTolerant(tc.input)
+			if diff := cmp.Diff(out, tc.expected); diff != "" {
 				t.Errorf("output differed:\n%s", diff)
 			}
+			if len(diags) != len(tc.diags) {
+				t.Errorf("got %d diagnostics, want %d", len(diags), len(tc.diags))
+			}
+			if diff := cmp.Diff(diags, tc.diags); diff != "" {
+				t.Errorf("diagnostics differed:\n%s", diff)
+			}
 		})
 	}
 }
+
+func TestAsciiEquationTolerantRandom(t *testing.T) {
+	tokens := []string{"a", "2", "+", "-", "*", "=", "/", "^", "_", "(", ")", "sqrt(", "int(", "root(", "∜", ",", "[[", "]", " ", "'"}
+	rng := rand.New(rand.NewSource(1))
+
+	for i := 0; i < 20000; i++ {
+		var b strings.Builder
+		for j := rng.Intn(10); j >= 0; j-- {
+			b.WriteString(tokens[rng.Intn(len(tokens))])
+		}
+		input := b.String()
+		out, diags := ParseASCIIEquationTolerant(input)
+
+		strict, err := ParseASCIIEquation(input)
+		switch {
+		case err == nil && len(diags) > 0:
+			t.Fatalf("ParseASCIIEquationTolerant(%q) returned %v for valid input", input, diags)
+		case err == nil:
+			if diff := cmp.Diff(out, strict); diff != "" {
+				t.Fatalf("ParseASCIIEquationTolerant(%q) differed from ParseASCIIEquation():\n%s", input, diff)
+			}
+		case len(diags) == 0:
+			t.Fatalf("ParseASCIIEquationTolerant(%q) returned no diagnostics, want %v", input, err)
+		case diags[0].Offset > err.(*ParseError).Offset:
+			t.Fatalf("ParseASCIIEquationTolerant(%q) first diagnostic = %v, want no later than %v", input, diags[0], err)
+		}
+		for j := 1; j < len(diags); j++ {
+			if *diags[j] == *diags[j-1] {
+				t.Fatalf("ParseASCIIEquationTolerant(%q) repeated diagnostic %v", input, diags[j])
+			}
+		}
+
+		// The recovered tree must be valid, unless the input is blank.
+		if out == nil && strings.Trim(input, " ,") != "" {
+			t.Fatalf("ParseASCIIEquationTolerant(%q) returned no tree", input)
+		}
+		if out != nil {
+			if _, err := FormatASCII(out); err != nil {
+				t.Fatalf("FormatASCII() of tolerant parse of %q failed: %v", input, err)
+			}
+		}
+	}
+}
+
+func TestPlaceholderGlyph(t *testing.T) {
+	r, err := NewRenderer(truetype.Options{Size: 24}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	n, _ := ParseASCIIEquationTolerant("1/")
+	if _, err := r.WithStrict(true).Measure(n); err != nil {
+		t.Errorf("Measure() failed: %v", err)
+	}
+}
@@ -0,0 +1,319 @@
+package eqdraw
+
+import (
+	"fmt"
+	"strings"
+)
+
+// asciiFormatter accumulates the ascii equation for a node tree.
+type asciiFormatter struct {
+	b strings.Builder
+}
+
+// FormatASCII returns the canonical ascii representation of a node tree, in
+// the syntax accepted by ParseASCIIEquation. Formatting the tree returned by
+// ParseASCIIEquation and parsing the result again gives an identical tree.
+//
+// Trees built by other means are formatted as closely as the syntax allows:
+// term styles are not represented, and nodes which the parser would not
+// produce in a given position are wrapped in parentheses. An error is
+// returned if the tree contains a node with no ascii equivalent, such as a
+// custom node, or a term containing a quote.
+func FormatASCII(n Node) (string, error) {
+	if n == nil {
+		return "", nil
+	}
+	var f asciiFormatter
+	if err := f.seq(n); err != nil {
+		return "", err
+	}
+	return f.b.String(), nil
+}
+
+// asciiOperator returns the operator a term represents within a sequence,
+// or 0 if it is not an operator.
+func asciiOperator(n Node) rune {
+	t, ok := n.(*Term)
+	if !ok || len(t.Content) != 1 {
+		return 0
+	}
+	switch c := t.Content[0]; c {
+	case '=', '+', '-', '*':
+		return c
+	}
+	return 0
+}
+
+// seq writes a node as a sequence of operands and operators, such as the
+// whole equation or the contents of parentheses.
+func (f *asciiFormatter) seq(n Node) error {
+	terms := []Node{n}
+	if r, ok := n.(*Run); ok {
+		terms = r.Terms
+	}
+
+	var prev Node // The previous operand, or nil after an operator.
+	for i, t := range terms {
+		op := asciiOperator(t)
+		switch {
+		case op != 0 && prev != nil && i+1 < len(terms):
+			// A binary operator.
+			f.b.WriteString(" " + string(op) + " ")
+			prev = nil
+			continue
+		case (op == '+' || op == '-') && prev == nil && i+1 < len(terms) && asciiOperator(terms[i+1]) == 0:
+			// A unary sign.
+			f.b.WriteRune(op)
+			continue
+		}
+
+		if prev != nil {
+			// Juxtaposed operands. Parentheses can follow a term directly,
+			// unless the term would then be read as a function name.
+			pt, isTerm := prev.(*Term)
+			_, isParen := t.(*Parenthesis)
+			if !isParen || !isTerm || asciiFuncs[string(pt.Content)] {
+				f.b.WriteString(" ")
+			}
+		}
+		if err := f.operand(t); err != nil {
+			return err
+		}
+		prev = t
+	}
+	return nil
+}
+
+// operand writes a node which is an operand within a sequence.
+func (f *asciiFormatter) operand(n Node) error {
+	switch n := n.(type) {
+	case *Term:
+		return f.term(n)
+
+	case *Parenthesis:
+		f.b.WriteString("(")
+		if n.Term != nil {
+			if err := f.seq(n.Term); err != nil {
+				return err
+			}
+		}
+		f.b.WriteString(")")
+		return nil
+
+	case *Root:
+		if n.Term == nil {
+			return fmt.Errorf("ascii: root with no term")
+		}
+		if n.Index != nil {
+			f.b.WriteString("root(")
+			if err := f.seq(n.Index); err != nil {
+				return err
+			}
+			f.b.WriteString(", ")
+		} else {
+			f.b.WriteString("sqrt(")
+		}
+		if err := f.seq(n.Term); err != nil {
+			return err
+		}
+		f.b.WriteString(")")
+		return nil
+
+	case *BigOp:
+		return f.bigOp(n)
+
+	case *Matrix:
+		return f.matrix(n)
+
+	case *Div:
+		if err := f.divOperand(n.Numerator, false); err != nil {
+			return err
+		}
+		f.b.WriteString("/")
+		return f.divOperand(n.Denominator, true)
+
+	case *Sup:
+		if err := f.base(n.Base); err != nil {
+			return err
+		}
+		f.b.WriteString("^")
+		return f.script(n.Exponent, true)
+
+	case *Sub:
+		if err := f.base(n.Base); err != nil {
+			return err
+		}
+		f.b.WriteString("_")
+		if err := f.script(n.Index, false); err != nil {
+			return err
+		}
+		if n.Exponent != nil {
+			f.b.WriteString("^")
+			return f.script(n.Exponent, true)
+		}
+		return nil
+
+	case *Run:
+		return f.group(n)
+	case nil:
+		return fmt.Errorf("ascii: missing operand")
+	}
+	return fmt.Errorf("ascii: unsupported node type %T", n)
+}
+
+// bigOp writes a large operator as a function, such as sum(i=1, n, i).
+func (f *asciiFormatter) bigOp(b *BigOp) error {
+	var name string
+	for n, op := range asciiBigOps {
+		if op == b.Op {
+			name = n
+		}
+	}
+	if name == "" {
+		return fmt.Errorf("ascii: unsupported operator %q", b.Op)
+	}
+	if b.Body == nil {
+		return fmt.Errorf("ascii: %s with no body", name)
+	}
+
+	args := []Node{b.Lower, b.Upper, b.Body}
+	switch {
+	case b.Upper == nil && b.Lower == nil:
+		args = args[2:]
+	case b.Upper == nil:
+		args = []Node{b.Lower, b.Body}
+	}
+	f.b.WriteString(name + "(")
+	for i, a := range args {
+		if i > 0 {
+			f.b.WriteString(", ")
+		}
+		if a == nil {
+			continue
+		}
+		if err := f.seq(a); err != nil {
+			return err
+		}
+	}
+	f.b.WriteString(")")
+	return nil
+}
+
+// matrix writes a matrix as a bracketed list of rows, such as
+// [[a, b], [c, d]]. The syntax has no way to express delimiters other than
+// brackets, column alignment or spacing, so these are not written.
+func (f *asciiFormatter) matrix(m *Matrix) error {
+	if len(m.Rows) == 0 {
+		// The closest the syntax allows is a single empty cell.
+		f.b.WriteString("[[]]")
+		return nil
+	}
+	f.b.WriteString("[")
+	for i, row := range m.Rows {
+		if i > 0 {
+			f.b.WriteString(", ")
+		}
+		f.b.WriteString("[")
+		for j, c := range row {
+			if j > 0 {
+				f.b.WriteString(", ")
+			}
+			if c == nil {
+				continue
+			}
+			if err := f.seq(c); err != nil {
+				return err
+			}
+		}
+		f.b.WriteString("]")
+	}
+	f.b.WriteString("]")
+	return nil
+}
+
+// group writes a node within parentheses, which the parser drops when they
+// enclose the operand of a division or script.
+func (f *asciiFormatter) group(n Node) error {
+	f.b.WriteString("(")
+	if err := f.seq(n); err != nil {
+		return err
+	}
+	f.b.WriteString(")")
+	return nil
+}
+
+// term writes a term, quoting it if it contains any characters which are
+// special to the parser.
+func (f *asciiFormatter) term(t *Term) error {
+	s := string(t.Content)
+	if strings.ContainsRune(s, '\'') {
+		return fmt.Errorf("ascii: term %q contains a quote", s)
+	}
+	if s == "" || strings.ContainsAny(s, "+-*/^_=()[], \t\n") || strings.IndexFunc(s, isASCIIRadical) >= 0 {
+		f.b.WriteString("'" + s + "'")
+		return nil
+	}
+	f.b.WriteString(s)
+	return nil
+}
+
+// divOperand writes the numerator or denominator of a division.
+func (f *asciiFormatter) divOperand(n Node, denominator bool) error {
+	switch n := n.(type) {
+	case *Term, *Root, *BigOp, *Matrix, *Sup, *Sub:
+		return f.operand(n)
+	case *Div:
+		// Divisions are left-associative.
+		if !denominator {
+			return f.operand(n)
+		}
+	case *Parenthesis:
+		if n.Term == nil {
+			return f.operand(n)
+		}
+	case *Run:
+		// A signed denominator, such as in 1/-x.
+		if denominator && len(n.Terms) == 2 {
+			if op := asciiOperator(n.Terms[0]); op == '+' || op == '-' {
+				f.b.WriteRune(op)
+				return f.divOperand(n.Terms[1], true)
+			}
+		}
+	}
+	return f.group(n)
+}
+
+// base writes the base of a script.
+func (f *asciiFormatter) base(n Node) error {
+	switch n.(type) {
+	case *Term, *Root, *BigOp, *Matrix, *Parenthesis:
+		return f.operand(n)
+	}
+	return f.group(n)
+}
+
+// script writes an exponent or index. Exponents may themselves have
+// exponents, as a^b^c is read as a^(b^c).
+func (f *asciiFormatter) script(n Node, exponent bool) error {
+	switch n := n.(type) {
+	case *Term, *Root, *BigOp, *Matrix:
+		return f.operand(n)
+	case *Sup:
+		if exponent {
+			return f.operand(n)
+		}
+	case *Parenthesis:
+		if n.Term == nil {
+			return f.operand(n)
+		}
+	case *Run:
+		// A signed script, such as in x^-1.
+		if len(n.Terms) == 2 {
+			if op := asciiOperator(n.Terms[0]); op == '+' || op == '-' {
+				f.b.WriteRune(op)
+				return f.script(n.Terms[1], exponent)
+			}
+		}
+	}
+	return f.group(n)
+}
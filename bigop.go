@@ -0,0 +1,271 @@
+package eqdraw
+
+import (
+	"image"
+
+	"golang.org/x/image/math/fixed"
+)
+
+// Large operators which can be drawn by a BigOp. Any other rune may be
+// used, provided a font has a glyph for it.
+const (
+	OpSum             = '∑'
+	OpProduct         = '∏'
+	OpCoproduct       = '∐'
+	OpIntegral        = '∫'
+	OpContourIntegral = '∮'
+)
+
+// bigOpDisplayScale is the minimum height of a large operator in display
+// style, relative to the height of text.
+const bigOpDisplayScale = 1.5
+
+// Spacing around large operators, in 26.6 fractions of an em.
+const (
+	// bigOpLimitGap is the gap between the operator and its limits.
+	bigOpLimitGap fixed.Int26_6 = 6 // ~0.1
+	// bigOpBodyGap is the gap between the operator and its body.
+	bigOpBodyGap fixed.Int26_6 = 10 // ~0.15
+)
+
+var (
+	bigOpMargin = LayoutResult{
+		Height: fixed.Int26_6(0 << 6),
+		Width:  fixed.Int26_6(2 << 6),
+	}
+)
+
+// BigOp represents a large operator, such as a summation or integral,
+// applied to a body. The operator is enlarged to the height of the body.
+// When parsed, the body runs up to the next relation, such as '=', or the
+// end of the sequence.
+//
+// In display style, the limits are drawn above and below the operator,
+// except for integrals, which conventionally have their limits beside the
+// operator. In inline style, the limits are always drawn beside it.
+type BigOp struct {
+	// Op is the operator drawn, such as OpSum.
+	Op rune
+	// Lower and Upper are the limits of the operator, either of which may
+	// be nil.
+	Lower, Upper Node
+	// Body may be nil.
+	Body Node
+}
+
+// bigOpLayout describes the placement of the parts of a BigOp, as computed
+// by its layout pass. Each position is relative to the top left of the
+// node, and is the top left of the part except for op, which is the origin
+// of the operator glyph.
+type bigOpLayout struct {
+	ff                     *Face
+	op, upper, lower, body fixed.Point26_6
+}
+
+// isIntegral returns true if op is an integral, which conventionally has
+// its limits beside it in every style.
+func isIntegral(op rune) bool {
+	switch op {
+	case OpIntegral, OpContourIntegral, '∬', '∭':
+		return true
+	}
+	return false
+}
+
+// isRelation returns true if r is a relation, such as '=' or '≤'. The body
+// of a large operator ends at the first relation in its sequence.
+func isRelation(r rune) bool {
+	switch r {
+	case '=', '<', '>', '≤', '≥', '≠', '≈', '≡', '∼', '∝', '→', '←', '⇒',
+		'⇐', '↔', '⇔', '∈', '∉', '⊂', '⊆':
+		return true
+	}
+	return false
+}
+
+// hasRelation returns true if n is a relation, or a run with a relation
+// among its terms. Such a body must be grouped when it is written, so it
+// is not ended at the relation when parsed.
+func hasRelation(n Node) bool {
+	switch n := n.(type) {
+	case *Term:
+		return len(n.Content) == 1 && isRelation(n.Content[0])
+	case *Run:
+		for _, t := range n.Terms {
+			if t, ok := t.(*Term); ok && hasRelation(t) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// limitsBeside returns true if the limits of the operator are drawn beside
+// it, rather than above and below it.
+func (b *BigOp) limitsBeside(dc *DrawContext) bool {
+	return dc.inline || isIntegral(b.Op)
+}
+
+// face returns the face to draw the operator with, which is at least h
+// tall.
+func (b *BigOp) face(dc *DrawContext, h fixed.Int26_6) (*Face, error) {
+	ff, _ := dc.stretchFace(h)
+	if ff.Font.Index(b.Op) != 0 {
+		return ff, nil
+	}
+	for _, f := range dc.fonts.Fallback {
+		if f.Index(b.Op) != 0 {
+			return dc.cache.face(f, ff.Options), nil
+		}
+	}
+	if dc.strict {
+		return nil, &MissingGlyphError{Rune: b.Op, Term: string(b.Op)}
+	}
+	return ff, nil
+}
+
+// Layout is called during the layout pass to compute the rendered size of this node.
+func (b *BigOp) Layout(dc *DrawContext) (*LayoutResult, error) {
+	var (
+		bb  *LayoutResult
+		err error
+	)
+	if b.Body != nil {
+		if bb, err = dc.Layout(b.Body); err != nil {
+			return nil, err
+		}
+	}
+
+	// Size the operator to its body, and in display style make it larger
+	// than the surrounding text.
+	var h fixed.Int26_6
+	if bb != nil {
+		h = bb.Height
+	}
+	if min := fixed.Int26_6(float64(dc.faces[faceSymbol].Metrics().Height) * bigOpDisplayScale); !dc.inline && min > h {
+		h = min
+	}
+	l := &bigOpLayout{}
+	if l.ff, err = b.face(dc, h); err != nil {
+		return nil, err
+	}
+
+	// Center the operator on the math axis. Coordinates are relative to
+	// the baseline of the node until the top of the node is known.
+	gb, adv, _ := l.ff.GlyphBounds(b.Op)
+	l.op.Y = -dc.mathAxis() - (gb.Min.Y+gb.Max.Y)/2
+	if gb.Min.X < 0 {
+		l.op.X = -gb.Min.X
+	}
+	opWidth := l.op.X + adv
+	if gb.Max.X > adv {
+		opWidth = l.op.X + gb.Max.X
+	}
+	opTop, opBottom := l.op.Y+gb.Min.Y, l.op.Y+gb.Max.Y
+
+	script := dc.scriptContext()
+	var ub, lb *LayoutResult
+	if b.Upper != nil {
+		if ub, err = script.Layout(b.Upper); err != nil {
+			return nil, err
+		}
+	}
+	if b.Lower != nil {
+		if lb, err = script.Layout(b.Lower); err != nil {
+			return nil, err
+		}
+	}
+
+	gap := dc.em().Mul(bigOpLimitGap)
+	width := opWidth
+	if b.limitsBeside(dc) {
+		// Hang the upper limit off the top of the operator, and the lower
+		// limit off its bottom.
+		if ub != nil {
+			l.upper = fixed.Point26_6{X: opWidth + gap, Y: opTop - ub.Ascent/4}
+			if w := opWidth + gap + ub.Width; w > width {
+				width = w
+			}
+		}
+		if lb != nil {
+			l.lower = fixed.Point26_6{X: opWidth + gap, Y: opBottom - lb.Ascent*3/4}
+			if w := opWidth + gap + lb.Width; w > width {
+				width = w
+			}
+		}
+	} else {
+		// Center the operator and its limits in a column.
+		if ub != nil && ub.Width > width {
+			width = ub.Width
+		}
+		if lb != nil && lb.Width > width {
+			width = lb.Width
+		}
+		l.op.X += (width - opWidth) / 2
+		if ub != nil {
+			l.upper = fixed.Point26_6{X: (width - ub.Width) / 2, Y: opTop - gap - ub.Height}
+		}
+		if lb != nil {
+			l.lower = fixed.Point26_6{X: (width - lb.Width) / 2, Y: opBottom + gap}
+		}
+	}
+
+	top, bottom := opTop, opBottom
+	extend := func(y, h fixed.Int26_6) {
+		if y < top {
+			top = y
+		}
+		if y+h > bottom {
+			bottom = y + h
+		}
+	}
+	if ub != nil {
+		extend(l.upper.Y, ub.Height)
+	}
+	if lb != nil {
+		extend(l.lower.Y, lb.Height)
+	}
+	if bb != nil {
+		width += dc.em().Mul(bigOpBodyGap)
+		l.body = fixed.Point26_6{X: width, Y: -bb.Ascent}
+		extend(l.body.Y, bb.Height)
+		width += bb.Width
+	}
+
+	// Make each position relative to the top of the node.
+	for _, p := range []*fixed.Point26_6{&l.op, &l.upper, &l.lower, &l.body} {
+		p.Y -= top
+	}
+	dc.states[b] = l
+	return &LayoutResult{
+		Width:  width + bigOpMargin.Width,
+		Height: bottom - top + bigOpMargin.Height,
+		Ascent: -top + bigOpMargin.Height/2,
+	}, nil
+}
+
+// Draw is called to render the operator, its limits and its body.
+func (b *BigOp) Draw(dc *DrawContext, pos fixed.Point26_6, clip image.Rectangle) error {
+	l := dc.states[b].(*bigOpLayout)
+	pos.X += bigOpMargin.Width / 2
+	pos.Y += bigOpMargin.Height / 2
+
+	dc.c.Glyph(l.ff, pos.Add(l.op), b.Op, dc.fg.C, clip)
+
+	script := dc.scriptContext()
+	script.c, script.fg = dc.c, dc.fg
+	if b.Upper != nil {
+		if err := b.Upper.Draw(script, pos.Add(l.upper), clip); err != nil {
+			return err
+		}
+	}
+	if b.Lower != nil {
+		if err := b.Lower.Draw(script, pos.Add(l.lower), clip); err != nil {
+			return err
+		}
+	}
+	if b.Body != nil {
+		return b.Body.Draw(dc, pos.Add(l.body), clip)
+	}
+	return nil
+}
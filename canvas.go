@@ -0,0 +1,332 @@
+package eqdraw
+
+import (
+	"container/list"
+	"image"
+	"image/color"
+	"image/draw"
+
+	"github.com/golang/freetype/truetype"
+	"golang.org/x/image/font"
+	"golang.org/x/image/math/fixed"
+	"golang.org/x/image/vector"
+)
+
+// Face is a font face, along with the font and options it was created
+// from. Vector backends can use the font to access glyph outlines.
+type Face struct {
+	font.Face
+	Font    *truetype.Font
+	Options truetype.Options
+}
+
+// faceMaskBytes bounds the memory allocated for the glyph cache of a face.
+// Each entry holds a mask the size of the largest glyph in the font, so
+// faces at large sizes cache fewer glyphs.
+const faceMaskBytes = 2 << 20
+
+func newFace(f *truetype.Font, o truetype.Options) *Face {
+	ff := &Face{Font: f, Options: o}
+	if o.GlyphCacheEntries == 0 {
+		b := f.Bounds(ff.scale())
+		mask := ((b.Max.X - b.Min.X).Ceil() + 1) * ((b.Max.Y - b.Min.Y).Ceil() + 1)
+		n := 512 // The truetype default.
+		for n > 1 && n*mask > faceMaskBytes {
+			n /= 2
+		}
+		o.GlyphCacheEntries = n
+	}
+	ff.Face = truetype.NewFace(f, &o)
+	return ff
+}
+
+// faceKey identifies a face by the font and options it is created from.
+type faceKey struct {
+	font *truetype.Font
+	o    truetype.Options
+}
+
+// maxCachedFaces bounds the number of faces held by a faceCache. Each face
+// allocates a glyph cache in proportion to its font size, so faces for
+// sizes which are no longer drawn must be released.
+const maxCachedFaces = 32
+
+// faceCache holds faces which have already been created, so they can be
+// reused across nodes and layout passes. Once full, the least recently used
+// face is evicted.
+type faceCache struct {
+	faces map[faceKey]*list.Element
+	// order holds a *cachedFace for each face, most recently used first.
+	order *list.List
+}
+
+type cachedFace struct {
+	key  faceKey
+	face *Face
+}
+
+func newFaceCache() *faceCache {
+	return &faceCache{faces: map[faceKey]*list.Element{}, order: list.New()}
+}
+
+// face returns the face for the font f with options o, creating it if it
+// is not yet in the cache.
+func (c *faceCache) face(f *truetype.Font, o truetype.Options) *Face {
+	k := faceKey{font: f, o: o}
+	if e, ok := c.faces[k]; ok {
+		c.order.MoveToFront(e)
+		return e.Value.(*cachedFace).face
+	}
+	ff := newFace(f, o)
+	c.faces[k] = c.order.PushFront(&cachedFace{key: k, face: ff})
+	if c.order.Len() > maxCachedFaces {
+		e := c.order.Back()
+		c.order.Remove(e)
+		delete(c.faces, e.Value.(*cachedFace).key)
+	}
+	return ff
+}
+
+// scale returns the number of 26.6 fixed point units in 1 em.
+func (f *Face) scale() fixed.Int26_6 {
+	size, dpi := f.Options.Size, f.Options.DPI
+	if size == 0 {
+		size = 12
+	}
+	if dpi == 0 {
+		dpi = 72
+	}
+	return fixed.Int26_6(0.5 + (size * dpi * 64 / 72))
+}
+
+// quantizeDot snaps dot to the same sub-pixel grid that truetype uses when
+// rasterizing a glyph, so glyphs in all backends are placed identically.
+func (f *Face) quantizeDot(dot fixed.Point26_6) fixed.Point26_6 {
+	qx, qy := 4, 1
+	switch f.Options.SubPixelsX {
+	case 1, 2, 4, 8, 16, 32, 64:
+		qx, qy = f.Options.SubPixelsX, f.Options.SubPixelsX
+	}
+	dot.X = (dot.X + 32/fixed.Int26_6(qx)) & (-64 / fixed.Int26_6(qx))
+	dot.Y = (dot.Y + 32/fixed.Int26_6(qy)) & (-64 / fixed.Int26_6(qy))
+	return dot
+}
+
+// GlyphPath returns the outline of the glyph for r, positioned with its
+// origin at dot. The advance of the glyph is also returned, and ok is false
+// if the face has no glyph for r.
+func (f *Face) GlyphPath(dot fixed.Point26_6, r rune) (p Path, advance fixed.Int26_6, ok bool) {
+	advance, ok = f.GlyphAdvance(r)
+	if !ok {
+		return nil, 0, false
+	}
+
+	var gb truetype.GlyphBuf
+	if err := gb.Load(f.Font, f.scale(), f.Font.Index(r), f.Options.Hinting); err != nil {
+		return nil, 0, false
+	}
+
+	dot = f.quantizeDot(dot)
+	start := 0
+	for _, end := range gb.Ends {
+		p.addContour(gb.Points[start:end], dot)
+		start = end
+	}
+	return p, advance, true
+}
+
+// PathOp describes the kind of a PathSegment.
+type PathOp uint8
+
+// Valid PathOp values.
+const (
+	PathMoveTo PathOp = iota
+	PathLineTo
+	PathQuadTo
+	PathClose
+)
+
+// PathSegment is a single step in a Path. Quadratic segments use both
+// points, the first being the control point. Other segments only use the
+// first point.
+type PathSegment struct {
+	Op  PathOp
+	Pts [2]fixed.Point26_6
+}
+
+// Path describes a shape made of closed contours. Paths are filled using
+// the non-zero winding rule.
+type Path []PathSegment
+
+// bounds returns the smallest rectangle containing every point of p,
+// including the control points of curves.
+func (p Path) bounds() image.Rectangle {
+	if len(p) == 0 {
+		return image.Rectangle{}
+	}
+	b := fixed.Rectangle26_6{Min: p[0].Pts[0], Max: p[0].Pts[0]}
+	for _, s := range p {
+		n := 1
+		switch s.Op {
+		case PathQuadTo:
+			n = 2
+		case PathClose:
+			continue
+		}
+		for _, pt := range s.Pts[:n] {
+			if pt.X < b.Min.X {
+				b.Min.X = pt.X
+			}
+			if pt.Y < b.Min.Y {
+				b.Min.Y = pt.Y
+			}
+			if pt.X > b.Max.X {
+				b.Max.X = pt.X
+			}
+			if pt.Y > b.Max.Y {
+				b.Max.Y = pt.Y
+			}
+		}
+	}
+	return image.Rect(b.Min.X.Floor(), b.Min.Y.Floor(), b.Max.X.Ceil(), b.Max.Y.Ceil())
+}
+
+// MoveTo starts a new contour at pt.
+func (p *Path) MoveTo(pt fixed.Point26_6) {
+	*p = append(*p, PathSegment{Op: PathMoveTo, Pts: [2]fixed.Point26_6{pt}})
+}
+
+// LineTo adds a straight line to pt.
+func (p *Path) LineTo(pt fixed.Point26_6) {
+	*p = append(*p, PathSegment{Op: PathLineTo, Pts: [2]fixed.Point26_6{pt}})
+}
+
+// QuadTo adds a quadratic Bézier curve to pt, with the given control point.
+func (p *Path) QuadTo(ctrl, pt fixed.Point26_6) {
+	*p = append(*p, PathSegment{Op: PathQuadTo, Pts: [2]fixed.Point26_6{ctrl, pt}})
+}
+
+// Close closes the current contour.
+func (p *Path) Close() {
+	*p = append(*p, PathSegment{Op: PathClose})
+}
+
+// addContour adds a closed contour of TrueType points, which are relative
+// to dot with the Y axis pointing up.
+func (p *Path) addContour(ps []truetype.Point, dot fixed.Point26_6) {
+	if len(ps) == 0 {
+		return
+	}
+	var (
+		onCurve = func(tp truetype.Point) bool { return tp.Flags&0x01 != 0 }
+		mid     = func(a, b truetype.Point) truetype.Point {
+			return truetype.Point{X: (a.X + b.X) / 2, Y: (a.Y + b.Y) / 2, Flags: 0x01}
+		}
+		pt = func(tp truetype.Point) fixed.Point26_6 {
+			return fixed.Point26_6{X: dot.X + tp.X, Y: dot.Y - tp.Y}
+		}
+	)
+
+	// Find an on-curve point to start from.
+	start, rest := ps[0], append([]truetype.Point{}, ps[1:]...)
+	if !onCurve(start) {
+		if last := ps[len(ps)-1]; onCurve(last) {
+			start, rest = last, append([]truetype.Point{}, ps[:len(ps)-1]...)
+		} else {
+			start, rest = mid(start, last), append([]truetype.Point{}, ps...)
+		}
+	}
+	rest = append(rest, start)
+
+	p.MoveTo(pt(start))
+	var (
+		ctrl    truetype.Point
+		hasCtrl bool
+	)
+	for _, tp := range rest {
+		switch {
+		case onCurve(tp) && hasCtrl:
+			p.QuadTo(pt(ctrl), pt(tp))
+			hasCtrl = false
+		case onCurve(tp):
+			p.LineTo(pt(tp))
+		case hasCtrl:
+			// Two consecutive off-curve points imply an on-curve point
+			// halfway between them.
+			p.QuadTo(pt(ctrl), pt(mid(ctrl, tp)))
+			ctrl = tp
+		default:
+			ctrl, hasCtrl = tp, true
+		}
+	}
+	p.Close()
+}
+
+// Canvas is a surface which nodes draw onto. Implementations provide the
+// output backend, such as a raster image or a vector document.
+type Canvas interface {
+	// Glyph draws the rune r from the given face, with the origin of the
+	// glyph at dot. The advance of the glyph is returned, and ok is false
+	// if the glyph could not be drawn.
+	Glyph(f *Face, dot fixed.Point26_6, r rune, c color.Color, clip image.Rectangle) (advance fixed.Int26_6, ok bool)
+	// FillRect fills the given rectangle with a solid color.
+	FillRect(r image.Rectangle, c color.Color, clip image.Rectangle)
+	// FillPath fills the given path with a solid color.
+	FillPath(p Path, c color.Color, clip image.Rectangle)
+}
+
+// RGBACanvas is a Canvas which rasterizes onto an RGBA image.
+type RGBACanvas struct {
+	Image *image.RGBA
+}
+
+// Glyph implements Canvas.
+func (rc *RGBACanvas) Glyph(f *Face, dot fixed.Point26_6, r rune, c color.Color, clip image.Rectangle) (fixed.Int26_6, bool) {
+	dr, mask, maskp, advance, ok := f.Glyph(dot, r)
+	if !ok {
+		return 0, false
+	}
+	draw.DrawMask(rc.Image, dr.Intersect(clip), image.NewUniform(c), image.Point{}, mask, maskp, draw.Over)
+	return advance, true
+}
+
+// FillRect implements Canvas.
+func (rc *RGBACanvas) FillRect(r image.Rectangle, c color.Color, clip image.Rectangle) {
+	draw.Draw(rc.Image, r.Intersect(clip), image.NewUniform(c), image.Point{}, draw.Over)
+}
+
+// FillPath implements Canvas.
+func (rc *RGBACanvas) FillPath(p Path, c color.Color, clip image.Rectangle) {
+	clip = clip.Intersect(rc.Image.Bounds())
+	if clip.Empty() {
+		return
+	}
+	var (
+		z  = vector.NewRasterizer(clip.Dx(), clip.Dy())
+		pt = func(p fixed.Point26_6) (float32, float32) {
+			return float32(p.X)/64 - float32(clip.Min.X), float32(p.Y)/64 - float32(clip.Min.Y)
+		}
+	)
+	z.DrawOp = draw.Over
+	for _, s := range p {
+		switch s.Op {
+		case PathMoveTo:
+			z.MoveTo(pt(s.Pts[0]))
+		case PathLineTo:
+			z.LineTo(pt(s.Pts[0]))
+		case PathQuadTo:
+			cx, cy := pt(s.Pts[0])
+			x, y := pt(s.Pts[1])
+			z.QuadTo(cx, cy, x, y)
+		case PathClose:
+			z.ClosePath()
+		}
+	}
+	z.Draw(rc.Image, clip, image.NewUniform(c), image.Point{})
+}
+
+// glyphRect returns the pixel rectangle covered by glyph bounds, for a
+// glyph drawn at dot.
+func glyphRect(b fixed.Rectangle26_6, dot fixed.Point26_6) image.Rectangle {
+	return image.Rect((dot.X + b.Min.X).Floor(), (dot.Y + b.Min.Y).Floor(), (dot.X + b.Max.X).Ceil(), (dot.Y + b.Max.Y).Ceil())
+}
@@ -0,0 +1,102 @@
+package eqdraw
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"testing"
+
+	"github.com/golang/freetype/truetype"
+	"golang.org/x/image/math/fixed"
+)
+
+func TestRecorder(t *testing.T) {
+	r, err := NewRenderer(truetype.Options{Size: 24}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var rec Recorder
+	n := &Div{
+		Numerator: &Sup{
+			Base:     &Term{Content: []rune{'x'}},
+			Exponent: &Term{Content: []rune{'2'}},
+		},
+		Denominator: &Term{Content: []rune{'3'}},
+	}
+	if err := r.Draw(&rec, n, nil); err != nil {
+		t.Fatalf("Draw() failed: %v", err)
+	}
+
+	want := []struct {
+		kind RecordedOpKind
+		r    rune
+		size float64
+	}{
+		{RecordedGlyph, 'x', 24},
+		{RecordedGlyph, '2', 24 * scriptScale},
+		{RecordedRect, 0, 0},
+		{RecordedGlyph, '3', 24},
+	}
+	if len(rec.Ops) != len(want) {
+		t.Fatalf("got %d ops, want %d: %+v", len(rec.Ops), len(want), rec.Ops)
+	}
+	for i, w := range want {
+		op := rec.Ops[i]
+		if op.Kind != w.kind || op.Rune != w.r || math.Abs(op.Size-w.size) > 1e-9 {
+			t.Errorf("op[%d] = {%v %q %v}, want {%v %q %v}", i, op.Kind, op.Rune, op.Size, w.kind, w.r, w.size)
+		}
+		if op.Color != color.Black {
+			t.Errorf("op[%d].Color = %v, want black", i, op.Color)
+		}
+	}
+}
+
+func TestRecorderClip(t *testing.T) {
+	var (
+		rec  Recorder
+		p    Path
+		clip = image.Rect(0, 0, 4, 4)
+	)
+	p.MoveTo(fixed.P(2, 2))
+	p.LineTo(fixed.P(6, 2))
+	p.LineTo(fixed.P(6, 6))
+	p.Close()
+	rec.FillPath(p, color.Black, clip)
+	rec.FillPath(p, color.Black, image.Rect(8, 8, 10, 10))
+	rec.FillRect(image.Rect(2, 2, 6, 6), color.Black, clip)
+	rec.FillRect(image.Rect(2, 2, 6, 6), color.Black, image.Rect(8, 8, 10, 10))
+
+	if len(rec.Ops) != 2 {
+		t.Fatalf("got %d ops, want 2: %+v", len(rec.Ops), rec.Ops)
+	}
+	if got := rec.Ops[0]; got.Kind != RecordedPath || got.Clip != clip {
+		t.Errorf("path op = %+v, want a path clipped to %v", got, clip)
+	}
+	if got, want := rec.Ops[1].Rect, image.Rect(2, 2, 4, 4); got != want {
+		t.Errorf("rect = %v, want %v", got, want)
+	}
+}
+
+func TestRGBACanvasFillPath(t *testing.T) {
+	var (
+		img = image.NewRGBA(image.Rect(0, 0, 10, 10))
+		c   = RGBACanvas{Image: img}
+		p   Path
+	)
+	p.MoveTo(fixed.P(2, 2))
+	p.LineTo(fixed.P(6, 2))
+	p.LineTo(fixed.P(6, 6))
+	p.LineTo(fixed.P(2, 6))
+	p.Close()
+	c.FillPath(p, color.Black, img.Bounds())
+
+	for y := 0; y < 10; y++ {
+		for x := 0; x < 10; x++ {
+			inside := x >= 2 && x < 6 && y >= 2 && y < 6
+			if got := img.RGBAAt(x, y).A == 0xff; got != inside {
+				t.Errorf("pixel (%d,%d) filled = %v, want %v", x, y, got, inside)
+			}
+		}
+	}
+}
@@ -0,0 +1,220 @@
+// Command eqdraw renders an equation to an image file.
+//
+// Usage:
+//
+//	eqdraw [flags] [equation]
+//	eqdraw serve [flags]
+//	eqdraw markdown [flags] [input.md]
+//
+// The equation is read from the arguments, or from stdin if there are none,
+// and is parsed with eqdraw.ParseASCIIEquation. The image is written to the
+// file named by -o, or to stdout.
+//
+// The serve subcommand runs an HTTP service rendering equations, as
+// described in the documentation of package serve. The markdown subcommand
+// replaces the math in a Markdown document with rendered images, as
+// described in the documentation of package markdown.
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/golang/freetype/truetype"
+	"github.com/twitchyliquid64/eqdraw"
+)
+
+// formats maps the names accepted by -format to the format they select.
+var formats = map[string]string{
+	"png":    "png",
+	"jpeg":   "jpeg",
+	"jpg":    "jpeg",
+	"gif":    "gif",
+	"svg":    "svg",
+	"mathml": "mathml",
+	"mml":    "mathml",
+	"latex":  "latex",
+	"tex":    "latex",
+}
+
+// options configures a render.
+type options struct {
+	size    float64
+	fg, bg  string
+	padding int
+	inline  bool
+	format  string
+	out     string
+}
+
+func (o *options) register(fs *flag.FlagSet) {
+	fs.Float64Var(&o.size, "size", 24, "font size, in points")
+	fs.StringVar(&o.fg, "fg", "black", "foreground color, as a name or #rrggbb[aa]")
+	fs.StringVar(&o.bg, "bg", "", "background color (default transparent, or white for jpeg)")
+	fs.IntVar(&o.padding, "padding", 0, "space around the equation, in pixels")
+	fs.BoolVar(&o.inline, "inline", false, "draw in inline style, with the limits of sums beside them")
+	fs.StringVar(&o.format, "format", "", "output format: png, jpeg, gif, svg, mathml or latex (default from -o, or png)")
+	fs.StringVar(&o.out, "o", "-", "output file, or - for stdout")
+}
+
+// outputFormat returns the format to write, from -format or the extension
+// of the output file.
+func (o *options) outputFormat() (string, error) {
+	name := o.format
+	if name == "" {
+		name = strings.TrimPrefix(filepath.Ext(o.out), ".")
+		if _, ok := formats[strings.ToLower(name)]; !ok {
+			name = "png"
+		}
+	}
+	f, ok := formats[strings.ToLower(name)]
+	if !ok {
+		return "", fmt.Errorf("unknown format %q", name)
+	}
+	return f, nil
+}
+
+// render draws the equation, writing it to w in the given format.
+func (o *options) render(w io.Writer, eq eqdraw.Node, format string) error {
+	switch format {
+	case "mathml":
+		return eqdraw.WriteMathML(w, eq, !o.inline)
+	case "latex":
+		s, err := eqdraw.FormatLaTeX(eq)
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintln(w, s)
+		return err
+	}
+
+	fg, err := eqdraw.ParseColor(o.fg)
+	if err != nil {
+		return err
+	}
+	bg := color.Color(color.Transparent)
+	switch {
+	case o.bg != "":
+		if bg, err = eqdraw.ParseColor(o.bg); err != nil {
+			return err
+		}
+	case format == "jpeg":
+		bg = color.White
+	}
+
+	r, err := eqdraw.NewRenderer(truetype.Options{Size: o.size}, nil)
+	if err != nil {
+		return err
+	}
+	r = r.WithPadding(o.padding).WithInline(o.inline)
+
+	var bgu *image.Uniform
+	if _, _, _, a := bg.RGBA(); a != 0 {
+		bgu = image.NewUniform(bg)
+	}
+	if format == "svg" {
+		return r.DrawSVG(w, eq, image.NewUniform(fg), bgu)
+	}
+	img, err := r.DrawRGBA(eq, image.NewUniform(fg), bgu)
+	if err != nil {
+		return err
+	}
+	switch format {
+	case "jpeg":
+		return jpeg.Encode(w, img, &jpeg.Options{Quality: 95})
+	case "gif":
+		return gif.Encode(w, img, nil)
+	}
+	return png.Encode(w, img)
+}
+
+// readEquation returns the equation given by args, or read from stdin if
+// there are no args.
+func readEquation(args []string, stdin io.Reader) (string, error) {
+	if len(args) > 0 && !(len(args) == 1 && args[0] == "-") {
+		return strings.Join(args, " "), nil
+	}
+	b, err := ioutil.ReadAll(stdin)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(b)), nil
+}
+
+func run(args []string, stdin io.Reader, stdout io.Writer) error {
+	if len(args) > 0 {
+		switch args[0] {
+		case "serve":
+			return runServe(args[1:])
+		case "markdown":
+			return runMarkdown(args[1:], stdin, stdout)
+		}
+	}
+
+	var (
+		o  options
+		fs = flag.NewFlagSet("eqdraw", flag.ContinueOnError)
+	)
+	o.register(fs)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: eqdraw [flags] [equation]\n       eqdraw serve [flags]\n       eqdraw markdown [flags] [input.md]\n\nflags:\n")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	format, err := o.outputFormat()
+	if err != nil {
+		return err
+	}
+	inp, err := readEquation(fs.Args(), stdin)
+	if err != nil {
+		return err
+	}
+	eq, err := eqdraw.ParseASCIIEquation(inp)
+	if err != nil {
+		var pe *eqdraw.ParseError
+		if errors.As(err, &pe) {
+			return fmt.Errorf("%v\n%s", err, pe.Snippet(inp))
+		}
+		return err
+	}
+	if eq == nil {
+		return errors.New("no equation given")
+	}
+
+	if o.out == "-" {
+		return o.render(stdout, eq, format)
+	}
+	f, err := os.Create(o.out)
+	if err != nil {
+		return err
+	}
+	if err := o.render(f, eq, format); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func main() {
+	err := run(os.Args[1:], os.Stdin, os.Stdout)
+	switch {
+	case err == flag.ErrHelp:
+	case err != nil:
+		fmt.Fprintf(os.Stderr, "eqdraw: %v\n", err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"bytes"
+	"image/color"
+	"image/png"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRun(t *testing.T) {
+	render := func(args ...string) *bytes.Buffer {
+		t.Helper()
+		var out bytes.Buffer
+		if err := run(args, strings.NewReader("x^2 + 1\n"), &out); err != nil {
+			t.Fatalf("run(%q) failed: %v", args, err)
+		}
+		return &out
+	}
+
+	plain, err := png.Decode(render())
+	if err != nil {
+		t.Fatal(err)
+	}
+	padded, err := png.Decode(render("-padding", "5", "-bg", "white", "x^2", "+", "1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := padded.Bounds().Dx(), plain.Bounds().Dx()+10; got != want {
+		t.Errorf("padded width = %d, want %d", got, want)
+	}
+	if got := color.RGBAModel.Convert(padded.At(0, 0)); got != (color.RGBA{0xff, 0xff, 0xff, 0xff}) {
+		t.Errorf("background = %v, want white", got)
+	}
+
+	if svg := render("-format", "svg"); !bytes.HasPrefix(svg.Bytes(), []byte("<svg")) {
+		t.Errorf("svg output = %q, want an svg document", svg)
+	}
+	if mml := render("-format", "mathml"); !bytes.HasPrefix(mml.Bytes(), []byte("<math")) {
+		t.Errorf("mathml output = %q, want a math element", mml)
+	}
+	if mml := render("-format", "mathml", "-inline"); bytes.Contains(mml.Bytes(), []byte(`display="block"`)) {
+		t.Errorf("inline mathml output = %q, want no display attribute", mml)
+	}
+	if tex := render("-format", "latex"); tex.String() != "x^{2} + 1\n" {
+		t.Errorf("latex output = %q, want %q", tex, "x^{2} + 1\n")
+	}
+
+	// The format is taken from the extension of the output file.
+	out := filepath.Join(t.TempDir(), "eq.svg")
+	if render("-o", out).Len() != 0 {
+		t.Error("output written to stdout, want file")
+	}
+	var o options
+	o.out = out
+	if f, _ := o.outputFormat(); f != "svg" {
+		t.Errorf("format = %q, want svg", f)
+	}
+
+	err = run([]string{"1 +"}, nil, &bytes.Buffer{})
+	if want := "missing operand after \"+\" at line 1, column 3\n1 +\n  ^"; err == nil || err.Error() != want {
+		t.Errorf("run() with invalid equation = %v, want %q", err, want)
+	}
+}
+
+func TestMarkdown(t *testing.T) {
+	var (
+		assets = filepath.Join(t.TempDir(), "img")
+		out    bytes.Buffer
+	)
+	err := run([]string{"markdown", "-assets", assets, "-link-prefix", "img", "-format", "svg"}, strings.NewReader("Area $pi r^2$.\n"), &out)
+	if err != nil {
+		t.Fatalf("run() failed: %v", err)
+	}
+	if !strings.HasPrefix(out.String(), "Area ![pi r^2](img/eq-") || !strings.HasSuffix(out.String(), ".svg).\n") {
+		t.Errorf("output = %q, want an image link", out.String())
+	}
+	if files, _ := filepath.Glob(filepath.Join(assets, "*.svg")); len(files) != 1 {
+		t.Errorf("images = %v, want 1", files)
+	}
+}
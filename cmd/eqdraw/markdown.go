@@ -0,0 +1,80 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+
+	"github.com/golang/freetype/truetype"
+	"github.com/twitchyliquid64/eqdraw"
+	"github.com/twitchyliquid64/eqdraw/markdown"
+)
+
+// runMarkdown implements the markdown subcommand, which replaces the math
+// in a Markdown document with images.
+func runMarkdown(args []string, stdin io.Reader, stdout io.Writer) error {
+	var (
+		fs      = flag.NewFlagSet("eqdraw markdown", flag.ContinueOnError)
+		size    = fs.Float64("size", 24, "font size, in points")
+		fg      = fs.String("fg", "black", "foreground color, as a name or #rrggbb[aa]")
+		bg      = fs.String("bg", "transparent", "background color")
+		padding = fs.Int("padding", 0, "space around each equation, in pixels")
+		format  = fs.String("format", "png", "image format: png or svg")
+		assets  = fs.String("assets", "assets", "directory to write images to")
+		prefix  = fs.String("link-prefix", "", "prefix of image links (default the assets directory)")
+		out     = fs.String("o", "-", "output file, or - for stdout")
+	)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: eqdraw markdown [flags] [input.md]\n\nflags:\n")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	var (
+		src []byte
+		err error
+	)
+	switch fs.NArg() {
+	case 0:
+		src, err = ioutil.ReadAll(stdin)
+	case 1:
+		src, err = ioutil.ReadFile(fs.Arg(0))
+	default:
+		return fmt.Errorf("unexpected arguments: %q", fs.Args()[1:])
+	}
+	if err != nil {
+		return err
+	}
+
+	opts := markdown.Options{
+		AssetsDir:  *assets,
+		LinkPrefix: *prefix,
+		Format:     *format,
+	}
+	if opts.Foreground, err = eqdraw.ParseColor(*fg); err != nil {
+		return err
+	}
+	if opts.Background, err = eqdraw.ParseColor(*bg); err != nil {
+		return err
+	}
+	if _, _, _, a := opts.Background.RGBA(); a == 0 {
+		opts.Background = nil
+	}
+	if opts.Renderer, err = eqdraw.NewRenderer(truetype.Options{Size: *size}, nil); err != nil {
+		return err
+	}
+	opts.Renderer = opts.Renderer.WithPadding(*padding)
+
+	doc, err := markdown.Process(src, opts)
+	if err != nil {
+		return err
+	}
+	if *out == "-" {
+		_, err = stdout.Write(doc)
+		return err
+	}
+	return ioutil.WriteFile(*out, doc, 0644)
+}
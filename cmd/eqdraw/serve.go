@@ -0,0 +1,50 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/twitchyliquid64/eqdraw/serve"
+)
+
+// runServe implements the serve subcommand, which serves rendered
+// equations over HTTP.
+func runServe(args []string) error {
+	var (
+		fs       = flag.NewFlagSet("eqdraw serve", flag.ContinueOnError)
+		addr     = fs.String("addr", "localhost:8080", "address to listen on")
+		cacheDir = fs.String("cache-dir", "", "directory to cache rendered images in (default memory only)")
+		memBytes = fs.Int64("cache-bytes", serve.DefaultMemoryCacheBytes, "size of the in-memory cache, in bytes")
+		maxSize  = fs.Float64("max-size", serve.DefaultMaxSize, "largest font size which may be requested")
+		maxPx    = fs.Int64("max-pixels", serve.DefaultMaxPixels, "largest image area, in pixels, which may be rendered")
+	)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: eqdraw serve [flags]\n\nflags:\n")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() > 0 {
+		return fmt.Errorf("unexpected arguments: %q", fs.Args())
+	}
+
+	opts := serve.Options{
+		CacheDir:         *cacheDir,
+		MemoryCacheBytes: *memBytes,
+		MaxSize:          *maxSize,
+		MaxPixels:        *maxPx,
+	}
+	if opts.MemoryCacheBytes == 0 {
+		opts.MemoryCacheBytes = -1
+	}
+	h, err := serve.New(opts)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("serving equations on http://%s/render.png", *addr)
+	return http.ListenAndServe(*addr, h)
+}
@@ -0,0 +1,42 @@
+package eqdraw
+
+import (
+	"fmt"
+	"image/color"
+	"strconv"
+	"strings"
+)
+
+// namedColors are the color names accepted by ParseColor, besides hex
+// values.
+var namedColors = map[string]color.Color{
+	"transparent": color.Transparent,
+	"black":       color.Black,
+	"white":       color.White,
+	"red":         color.RGBA{R: 0xff, A: 0xff},
+	"green":       color.RGBA{G: 0x80, A: 0xff},
+	"blue":        color.RGBA{B: 0xff, A: 0xff},
+}
+
+// ParseColor parses a color name, such as black or transparent, or a hex
+// color in the form #rgb, #rrggbb or #rrggbbaa. The leading # is optional.
+func ParseColor(s string) (color.Color, error) {
+	if c, ok := namedColors[strings.ToLower(s)]; ok {
+		return c, nil
+	}
+
+	hex := strings.TrimPrefix(s, "#")
+	if len(hex) == 3 {
+		hex = string([]byte{hex[0], hex[0], hex[1], hex[1], hex[2], hex[2]})
+	}
+	if len(hex) == 6 {
+		hex += "ff"
+	}
+	v, err := strconv.ParseUint(hex, 16, 32)
+	if len(hex) != 8 || err != nil {
+		return nil, fmt.Errorf("invalid color %q", s)
+	}
+	// color.RGBA is alpha-premultiplied.
+	nrgba := color.NRGBA{R: uint8(v >> 24), G: uint8(v >> 16), B: uint8(v >> 8), A: uint8(v)}
+	return color.RGBAModel.Convert(nrgba), nil
+}
@@ -0,0 +1,40 @@
+package eqdraw
+
+import (
+	"image/color"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestParseColor(t *testing.T) {
+	tcs := []struct {
+		in   string
+		want color.Color
+		err  bool
+	}{
+		{in: "black", want: color.Black},
+		{in: "White", want: color.White},
+		{in: "#f00", want: color.RGBA{R: 0xff, A: 0xff}},
+		{in: "#102030", want: color.RGBA{R: 0x10, G: 0x20, B: 0x30, A: 0xff}},
+		{in: "ff000080", want: color.RGBA{R: 0x80, A: 0x80}},
+		{in: "#12", err: true},
+		{in: "#gggggg", err: true},
+	}
+	for _, tc := range tcs {
+		got, err := ParseColor(tc.in)
+		if tc.err {
+			if err == nil {
+				t.Errorf("ParseColor(%q) succeeded, want error", tc.in)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParseColor(%q) failed: %v", tc.in, err)
+			continue
+		}
+		if diff := cmp.Diff(got, tc.want); diff != "" {
+			t.Errorf("ParseColor(%q) differed:\n%s", tc.in, diff)
+		}
+	}
+}
@@ -0,0 +1,66 @@
+package eqdraw
+
+// Text returns a term which draws the given text.
+func Text(s string) *Term {
+	return &Term{Content: []rune(s)}
+}
+
+// Seq returns a run which draws the given nodes side-by-side. None of the
+// nodes may be nil.
+func Seq(terms ...Node) *Run {
+	return &Run{Terms: terms}
+}
+
+// Frac returns a node which draws num divided by den, neither of which may
+// be nil.
+func Frac(num, den Node) *Div {
+	return &Div{Numerator: num, Denominator: den}
+}
+
+// Sqrt returns a node which draws the square root of x. If x is nil, an
+// empty surd is drawn.
+func Sqrt(x Node) *Root {
+	return &Root{Term: x}
+}
+
+// NthRoot returns a node which draws the nth root of x, such as a cube root
+// when n is 3. If n is nil, the root is a square root.
+func NthRoot(n, x Node) *Root {
+	return &Root{Term: x, Index: n}
+}
+
+// Paren returns a node which draws x within parentheses. If x is nil, empty
+// parentheses are drawn.
+func Paren(x Node) *Parenthesis {
+	return &Parenthesis{Term: x}
+}
+
+// Pow returns a node which draws base raised to exp. The base may not be
+// nil.
+func Pow(base, exp Node) *Sup {
+	return &Sup{Base: base, Exponent: exp}
+}
+
+// Subscript returns a node which draws base with the subscript idx. The
+// base may not be nil.
+func Subscript(base, idx Node) *Sub {
+	return &Sub{Base: base, Index: idx}
+}
+
+// SubSup returns a node which draws base with the subscript idx and
+// exponent exp stacked on top of each other. The base may not be nil.
+func SubSup(base, idx, exp Node) *Sub {
+	return &Sub{Base: base, Index: idx, Exponent: exp}
+}
+
+// Sum returns a node which draws the sum of body from lower to upper. Either
+// limit may be nil.
+func Sum(lower, upper, body Node) *BigOp {
+	return &BigOp{Op: OpSum, Lower: lower, Upper: upper, Body: body}
+}
+
+// Integral returns a node which draws the integral of body from lower to
+// upper. Either limit may be nil.
+func Integral(lower, upper, body Node) *BigOp {
+	return &BigOp{Op: OpIntegral, Lower: lower, Upper: upper, Body: body}
+}
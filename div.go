@@ -7,7 +7,7 @@ import (
 )
 
 var (
-	divMargin = layoutResult{
+	divMargin = LayoutResult{
 		Height: fixed.Int26_6(8 << 6),
 		Width:  fixed.Int26_6(2 << 6),
 	}
@@ -17,51 +17,45 @@ var (
 
 // Div represents one term dividing another
 type Div struct {
-	layout *layoutResult
-
-	Numerator   node
-	Denominator node
-}
-
-// Bounds returns the width and height of the rendered term, as computed by
-// the last layout pass. If no layout pass has occurred, the returned value
-// will be nil.
-func (d *Div) Bounds() *layoutResult {
-	return d.layout
+	Numerator   Node
+	Denominator Node
 }
 
 // Layout is called during the layout pass to compute the rendered size of this node.
-func (d *Div) Layout(dc *DrawContext) error {
+func (d *Div) Layout(dc *DrawContext) (*LayoutResult, error) {
 	sz := divMargin
 	sz.Height += fixed.I(divLineThickness) + fixed.I(divLineSpacing*2)
 
-	if err := d.Numerator.Layout(dc); err != nil {
-		return err
+	nb, err := dc.Layout(d.Numerator)
+	if err != nil {
+		return nil, err
 	}
-	if err := d.Denominator.Layout(dc); err != nil {
-		return err
+	db, err := dc.Layout(d.Denominator)
+	if err != nil {
+		return nil, err
 	}
-	nb := d.Numerator.Bounds()
 	sz.Height += nb.Height
-	db := d.Denominator.Bounds()
 	sz.Height += db.Height
 
+	// Center the line on the math axis.
+	sz.Ascent = divMargin.Height/2 + nb.Height + fixed.I(divLineSpacing) + fixed.I(divLineThickness)/2 + dc.mathAxis()
+
 	if nb.Width > db.Width {
 		sz.Width += nb.Width
 	} else {
 		sz.Width += db.Width
 	}
 
-	d.layout = &sz
-	return nil
+	return &sz, nil
 }
 
 // Draw is called to render the parentheses and its contained terms.
 func (d *Div) Draw(dc *DrawContext, pos fixed.Point26_6, clip image.Rectangle) error {
 	pos.Y += divMargin.Height / 2
 
-	nb := d.Numerator.Bounds()
-	adjX := (d.layout.Width - nb.Width + 1) / 2
+	width := dc.Bounds(d).Width
+	nb := dc.Bounds(d.Numerator)
+	adjX := (width - nb.Width + 1) / 2
 	pos.X += adjX
 	if err := d.Numerator.Draw(dc, pos, clip); err != nil {
 		return err
@@ -69,15 +63,12 @@ func (d *Div) Draw(dc *DrawContext, pos fixed.Point26_6, clip image.Rectangle) e
 	pos.X -= adjX
 	pos.Y += nb.Height + fixed.I(divLineSpacing)
 
-	for x := 1; x < d.layout.Width.Ceil()-2; x++ {
-		for y := 0; y < divLineThickness; y++ {
-			dc.out.Set(pos.X.Round()+x, pos.Y.Round()+y, dc.fg.C)
-		}
-	}
+	x, y := pos.X.Round(), pos.Y.Round()
+	dc.c.FillRect(image.Rect(x+1, y, x+width.Ceil()-2, y+divLineThickness), dc.fg.C, clip)
 
 	pos.Y += fixed.I(divLineThickness) + fixed.I(divLineSpacing)
-	db := d.Denominator.Bounds()
-	adjX = (d.layout.Width - db.Width + 1) / 2
+	db := dc.Bounds(d.Denominator)
+	adjX = (width - db.Width + 1) / 2
 	pos.X += adjX
 	if err := d.Denominator.Draw(dc, pos, clip); err != nil {
 		return err
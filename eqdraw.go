@@ -2,90 +2,438 @@
 package eqdraw
 
 import (
+	"errors"
 	"fmt"
 	"image"
 	"image/color"
 	"image/draw"
+	"math"
+	"sync"
 
 	"github.com/golang/freetype/truetype"
-	"golang.org/x/image/font"
 	"golang.org/x/image/math/fixed"
 )
 
-type layoutResult struct {
+// LayoutResult describes the size of a node, as computed by its layout pass.
+type LayoutResult struct {
 	Width, Height fixed.Int26_6
+	// Ascent is the distance from the top of the node to its baseline.
+	Ascent fixed.Int26_6
 }
 
-type node interface {
-	// Layout walks the node tree, recursively computing the sizes of each node.
-	Layout(*DrawContext) error
+// Descent returns the distance from the baseline of the node to its bottom.
+func (l LayoutResult) Descent() fixed.Int26_6 {
+	return l.Height - l.Ascent
+}
+
+// Node is an element of an equation, which can be laid out and drawn. Nodes
+// are assembled into a tree, typically by one of the parsers or the
+// constructor helpers such as Frac or Seq.
+//
+// Nodes do not store the results of laying them out, so a tree can be
+// drawn by many goroutines at once. The results are instead held by the
+// DrawContext, keyed by node, so nodes must be comparable; typically they
+// are pointers.
+//
+// Custom nodes can be implemented outside this package, drawing through
+// the Canvas and faces exposed by the DrawContext.
+type Node interface {
+	// Layout computes the size of the node. Child nodes should be laid out
+	// by calling dc.Layout.
+	Layout(dc *DrawContext) (*LayoutResult, error)
 	// Draw draws the node using the provided information and drawContext.
+	// The sizes of the node and its children, as computed by the layout
+	// pass, are available from dc.Bounds.
 	Draw(dc *DrawContext, pos fixed.Point26_6, clip image.Rectangle) error
-	// Bounds returns the width and height of the rendered term, as computed by
-	// the last layout pass. If no layout pass has occurred, the returned value
-	// will be nil.
-	Bounds() *layoutResult
 }
 
-// DrawContext represents a context that can be used for generating
-// equation renders.
-type DrawContext struct {
-	o   truetype.Options
-	ff  font.Face
-	ffi font.Face // italic font face
-	f   *truetype.Font
+// Renderer holds the configuration used to draw equations, such as the
+// font size and fonts. A Renderer is immutable, and safe for concurrent
+// use by multiple goroutines.
+type Renderer struct {
+	o       truetype.Options
+	fonts   FontSet
+	strict  bool
+	padding int
+	inline  bool
 
-	fg  *image.Uniform
-	out *image.RGBA
+	// caches holds faceCache values which are not in use by a render, so
+	// faces can be reused across renders. It is shared by all renderers
+	// derived from the same call to NewRenderer.
+	caches *sync.Pool
 }
 
-// NewContext creates a new drawing context.
-func NewContext(o truetype.Options) (*DrawContext, error) {
-	f, err := DefaultFontRegular()
+// NewRenderer creates a new renderer. If fonts is nil, the default font
+// set is used. Fonts missing from the set are substituted with the closest
+// font that is present.
+func NewRenderer(o truetype.Options, fonts *FontSet) (*Renderer, error) {
+	if fonts == nil {
+		var err error
+		if fonts, err = DefaultFontSet(); err != nil {
+			return nil, err
+		}
+	}
+	fs, err := fonts.complete()
 	if err != nil {
 		return nil, err
 	}
 
-	ff := truetype.NewFace(f, &o)
+	return &Renderer{
+		o:     o,
+		fonts: fs,
+		caches: &sync.Pool{
+			New: func() interface{} { return newFaceCache() },
+		},
+	}, nil
+}
+
+// Options returns the options font faces are created with.
+func (r *Renderer) Options() truetype.Options {
+	return r.o
+}
+
+// WithOptions returns a copy of the renderer, which creates font faces
+// with the given options.
+func (r *Renderer) WithOptions(o truetype.Options) *Renderer {
+	out := *r
+	out.o = o
+	return &out
+}
+
+// WithSize returns a copy of the renderer, which draws equations at the
+// given font size.
+func (r *Renderer) WithSize(size float64) *Renderer {
+	o := r.o
+	o.Size = size
+	return r.WithOptions(o)
+}
+
+// Fonts returns the fonts equations are drawn with.
+func (r *Renderer) Fonts() FontSet {
+	return r.fonts
+}
+
+// Padding returns the number of pixels of space around equations.
+func (r *Renderer) Padding() int {
+	return r.padding
+}
+
+// Inline returns true if the renderer draws equations in inline style.
+func (r *Renderer) Inline() bool {
+	return r.inline
+}
+
+// WithStrict returns a copy of the renderer with strict mode set. In
+// strict mode, laying out a term containing a rune which no font has a
+// glyph for returns a *MissingGlyphError, rather than drawing the font's
+// placeholder glyph.
+func (r *Renderer) WithStrict(strict bool) *Renderer {
+	out := *r
+	out.strict = strict
+	return &out
+}
 
-	fi, err := DefaultFontItalic()
+// WithPadding returns a copy of the renderer, which surrounds equations
+// with the given number of pixels of space.
+func (r *Renderer) WithPadding(padding int) *Renderer {
+	out := *r
+	out.padding = padding
+	return &out
+}
+
+// WithInline returns a copy of the renderer which draws equations in inline
+// style, to sit within a line of text, rather than in display style. In
+// inline style, the limits of large operators such as sums are drawn beside
+// the operator rather than above and below it, and the operator is not
+// enlarged.
+func (r *Renderer) WithInline(inline bool) *Renderer {
+	out := *r
+	out.inline = inline
+	return &out
+}
+
+// newContext returns a context for a single render. The caller must call
+// release once the render is complete.
+func (r *Renderer) newContext() *DrawContext {
+	dc := &DrawContext{
+		fonts:   &r.fonts,
+		strict:  r.strict,
+		padding: r.padding,
+		inline:  r.inline,
+		cache:   r.caches.Get().(*faceCache),
+	}
+	dc.reset(r.o)
+	return dc
+}
+
+// release returns the faces used by a context to the renderer, for use by
+// later renders.
+func (r *Renderer) release(dc *DrawContext) {
+	r.caches.Put(dc.cache)
+}
+
+// DrawContext holds the state of a single render: the layout of each node,
+// and the canvas being drawn onto. It is passed to the methods of each Node,
+// and must not be retained after they return.
+type DrawContext struct {
+	o       truetype.Options
+	fonts   *FontSet
+	strict  bool
+	padding int
+	inline  bool
+	// faces holds the face for each FontStyle at the current size, and
+	// the symbol face at faceSymbol.
+	faces    [faceSymbol + 1]*Face
+	fallback []*Face
+	// cache holds every face created by the context, and is shared with
+	// the contexts derived from it.
+	cache *faceCache
+
+	layouts map[Node]*LayoutResult
+	// states holds data computed by the layout pass of builtin nodes,
+	// which is needed to draw them.
+	states map[Node]interface{}
+	// script is the context superscripts and subscripts are laid out
+	// and drawn in, created on first use.
+	script *DrawContext
+
+	fg *image.Uniform
+	c  Canvas
+}
+
+// reset sets the options used to create font faces, such as the font size,
+// and clears any layout results.
+func (dc *DrawContext) reset(o truetype.Options) {
+	dc.o = o
+	for s := StyleRegular; s <= StyleBoldItalic; s++ {
+		dc.faces[s] = dc.cache.face(dc.fonts.font(s), o)
+	}
+	dc.faces[StyleAuto] = dc.faces[StyleRegular]
+	dc.faces[faceSymbol] = dc.cache.face(dc.fonts.Symbol, o)
+
+	dc.fallback = make([]*Face, len(dc.fonts.Fallback))
+	for i, f := range dc.fonts.Fallback {
+		dc.fallback[i] = dc.cache.face(f, o)
+	}
+
+	dc.layouts = map[Node]*LayoutResult{}
+	dc.states = map[Node]interface{}{}
+	dc.script = nil
+}
+
+// Layout lays out the node n, recording its size for the draw pass. An
+// error is returned if n is nil, such as for a missing child of a node
+// which requires one.
+func (dc *DrawContext) Layout(n Node) (*LayoutResult, error) {
+	if n == nil {
+		return nil, errors.New("nil node")
+	}
+	sz, err := n.Layout(dc)
 	if err != nil {
 		return nil, err
 	}
-	ffi := truetype.NewFace(fi, &o)
+	dc.layouts[n] = sz
+	return sz, nil
+}
 
-	return &DrawContext{
-		o:   o,
-		f:   f,
-		ff:  ff,
-		ffi: ffi,
-	}, nil
+// Bounds returns the size of n, as computed by the layout pass. If n has
+// not been laid out in this context, the returned value will be nil.
+func (dc *DrawContext) Bounds(n Node) *LayoutResult {
+	return dc.layouts[n]
 }
 
-// DrawRGBA generates a RGBA image by drawing the given node. If uniform
-// is non-nil, it will be drawn over the entire image before rendering
-// the equation.
-func (dc *DrawContext) DrawRGBA(n node, fg, bg *image.Uniform) (*image.RGBA, error) {
-	if err := n.Layout(dc); err != nil {
-		return nil, fmt.Errorf("layout: %w", err)
+// glyphFace returns the face to draw the rune r with: f if its font has a
+// glyph for r, or otherwise the first fallback face which does. If no font
+// has a glyph for r, f is returned and ok is false.
+func (dc *DrawContext) glyphFace(f *Face, r rune) (face *Face, ok bool) {
+	if f.Font.Index(r) != 0 {
+		return f, true
+	}
+	for _, fb := range dc.fallback {
+		if fb.Font.Index(r) != 0 {
+			return fb, true
+		}
 	}
-	bounds := image.Rectangle{Max: image.Point{X: n.Bounds().Width.Ceil(), Y: n.Bounds().Height.Ceil()}}
+	return f, false
+}
 
-	canvas := image.NewRGBA(bounds)
-	if bg != nil {
-		draw.Draw(canvas, bounds, bg, image.Point{}, draw.Over)
+// scriptContext returns a context with the font size reduced, for laying
+// out and drawing superscripts and subscripts.
+func (dc *DrawContext) scriptContext() *DrawContext {
+	if dc.script != nil {
+		return dc.script
 	}
-	dc.out = canvas
 
+	o := dc.o
+	o.Size *= scriptScale
+	if o.Size < scriptMinSize {
+		o.Size = scriptMinSize
+	}
+	dc.script = &DrawContext{
+		fonts:  dc.fonts,
+		strict: dc.strict,
+		inline: true,
+		cache:  dc.cache,
+	}
+	dc.script.reset(o)
+	return dc.script
+}
+
+// stretchMaxSize bounds the font size of stretched symbols, such as
+// parentheses and surds.
+const stretchMaxSize = 144
+
+// stretchGlyphCacheEntries is the size of the glyph cache of faces used to
+// draw stretched symbols, which only draw a few glyphs each.
+const stretchGlyphCacheEntries = 16
+
+// stretchOptions returns the options of the face used to draw stretched
+// symbols a whole number of points larger than o.
+func stretchOptions(o truetype.Options, step int) truetype.Options {
+	if step > 0 {
+		o.Size += float64(step)
+		o.GlyphCacheEntries = stretchGlyphCacheEntries
+	}
+	return o
+}
+
+// stretchFace returns the smallest symbol face which is at least h tall,
+// at the current font size or a whole number of points larger, up to
+// stretchMaxSize. If no such face exists, the largest face is returned and
+// ok is false.
+func (dc *DrawContext) stretchFace(h fixed.Int26_6) (f *Face, ok bool) {
+	n := int(math.Ceil(stretchMaxSize - dc.o.Size))
+	if n <= 0 {
+		return dc.faces[faceSymbol], dc.faces[faceSymbol].Metrics().Height >= h
+	}
+	face := func(step int) *Face {
+		return dc.cache.face(dc.fonts.Symbol, stretchOptions(dc.o, step))
+	}
+
+	// The height of a face is proportional to its size, so estimate the
+	// number of points to add, then correct for any rounding.
+	step := 0
+	if bh := dc.faces[faceSymbol].Metrics().Height; bh > 0 && bh < h {
+		step = int(math.Ceil(dc.o.Size * (float64(h)/float64(bh) - 1)))
+		if step > n-1 {
+			step = n - 1
+		}
+	}
+	for step > 0 && face(step-1).Metrics().Height >= h {
+		step--
+	}
+	for step < n-1 && face(step).Metrics().Height < h {
+		step++
+	}
+	f = face(step)
+	return f, f.Metrics().Height >= h
+}
+
+// Canvas returns the canvas being drawn onto. It is only valid during a
+// call to Draw.
+func (dc *DrawContext) Canvas() Canvas {
+	return dc.c
+}
+
+// Foreground returns the color equations are being drawn in. It is only
+// valid during a call to Draw.
+func (dc *DrawContext) Foreground() color.Color {
+	return dc.fg.C
+}
+
+// Inline returns true if nodes are being drawn in inline style, as set by
+// Renderer.WithInline. Superscripts and subscripts are always drawn in
+// inline style.
+func (dc *DrawContext) Inline() bool {
+	return dc.inline
+}
+
+// Face returns the font face for the given style, at the current font size.
+// StyleAuto returns the regular face.
+func (dc *DrawContext) Face(s FontStyle) *Face {
+	return dc.faces[s]
+}
+
+// em returns the size of one em in the current font size.
+func (dc *DrawContext) em() fixed.Int26_6 {
+	return dc.faces[StyleRegular].scale()
+}
+
+// mathAxis returns the height above the baseline of the math axis: the
+// line which fraction bars and operators such as '+' are centered on.
+func (dc *DrawContext) mathAxis() fixed.Int26_6 {
+	b, _, ok := dc.faces[StyleRegular].GlyphBounds('+')
+	if !ok {
+		return dc.faces[StyleRegular].Metrics().XHeight / 2
+	}
+	return -(b.Min.Y + b.Max.Y) / 2
+}
+
+// layout runs the layout pass over n, returning the bounds of the image
+// it should be drawn into, including any padding.
+func (dc *DrawContext) layout(n Node) (image.Rectangle, error) {
+	sz, err := dc.Layout(n)
+	if err != nil {
+		return image.Rectangle{}, fmt.Errorf("layout: %w", err)
+	}
+	return image.Rectangle{Max: image.Point{
+		X: sz.Width.Ceil() + 2*dc.padding,
+		Y: sz.Height.Ceil() + 2*dc.padding,
+	}}, nil
+}
+
+// render draws a node which has been laid out onto the given canvas.
+func (dc *DrawContext) render(c Canvas, n Node, fg *image.Uniform, bounds image.Rectangle) error {
+	dc.c = c
 	if fg == nil {
 		dc.fg = image.NewUniform(color.Black)
 	} else {
 		dc.fg = fg
 	}
-	err := n.Draw(dc, fixed.Point26_6{}, bounds)
+	if err := n.Draw(dc, fixed.P(dc.padding, dc.padding), bounds); err != nil {
+		return fmt.Errorf("draw: %w", err)
+	}
+	return nil
+}
+
+// Measure computes the bounds of the image a node would be drawn into.
+func (r *Renderer) Measure(n Node) (image.Rectangle, error) {
+	dc := r.newContext()
+	defer r.release(dc)
+	return dc.layout(n)
+}
+
+// Draw lays out and draws the given node onto a canvas, with the top-left
+// of the equation at the origin, offset by any padding. The canvas should
+// cover the bounds returned by Measure. If fg is nil, the equation is drawn
+// in black.
+func (r *Renderer) Draw(c Canvas, n Node, fg *image.Uniform) error {
+	dc := r.newContext()
+	defer r.release(dc)
+	bounds, err := dc.layout(n)
 	if err != nil {
-		return nil, fmt.Errorf("draw: %w", err)
+		return err
+	}
+	return dc.render(c, n, fg, bounds)
+}
+
+// DrawRGBA generates a RGBA image by drawing the given node. If uniform
+// is non-nil, it will be drawn over the entire image before rendering
+// the equation.
+func (r *Renderer) DrawRGBA(n Node, fg, bg *image.Uniform) (*image.RGBA, error) {
+	dc := r.newContext()
+	defer r.release(dc)
+	bounds, err := dc.layout(n)
+	if err != nil {
+		return nil, err
+	}
+
+	out := image.NewRGBA(bounds)
+	if bg != nil {
+		draw.Draw(out, bounds, bg, image.Point{}, draw.Over)
+	}
+	if err := dc.render(&RGBACanvas{Image: out}, n, fg, bounds); err != nil {
+		return nil, err
 	}
-	dc.out = nil
-	return canvas, nil
+	return out, nil
 }
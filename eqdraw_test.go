@@ -1,102 +1,116 @@
 package eqdraw
 
 import (
+	"bytes"
+	"errors"
 	"image"
 	"image/color"
 	"image/png"
 	"os"
+	"sync"
 	"testing"
 
 	"github.com/golang/freetype/truetype"
+	"github.com/google/go-cmp/cmp"
 	"golang.org/x/image/math/fixed"
 )
 
 func testContext(t *testing.T, sz image.Rectangle) *DrawContext {
 	t.Helper()
-	f, err := DefaultFontRegular()
+	r, err := NewRenderer(truetype.Options{Size: 24}, nil)
 	if err != nil {
 		t.Fatal(err)
 	}
-	o := truetype.Options{
-		Size: 24,
-	}
-	ff := truetype.NewFace(f, &o)
-
-	fi, err := DefaultFontItalic()
-	if err != nil {
-		t.Fatal(err)
-	}
-	ffi := truetype.NewFace(fi, &o)
-
-	return &DrawContext{
-		o:   o,
-		f:   f,
-		ff:  ff,
-		ffi: ffi,
-		out: image.NewRGBA(sz),
-	}
+	dc := r.newContext()
+	dc.c = &RGBACanvas{Image: image.NewRGBA(sz)}
+	return dc
 }
 
 func TestLayout(t *testing.T) {
 	tcs := []struct {
 		name    string
-		node    node
-		results layoutResult
+		node    Node
+		results LayoutResult
 	}{
 		{
 			"term",
 			&Term{Content: []rune{'h', 'e', 'l', 'l', 'o'}},
-			layoutResult{
+			LayoutResult{
 				Width:  fixed.Int26_6(56<<6 + 44),
 				Height: fixed.Int26_6(27<<6 + 0),
+				Ascent: fixed.Int26_6(23<<6 + 15),
 			},
 		},
 		{
 			"empty_parentheses",
 			&Parenthesis{},
-			layoutResult{
+			LayoutResult{
 				Width:  fixed.Int26_6(17<<6 + 0),
 				Height: fixed.Int26_6(36<<6 + 0),
+				Ascent: fixed.Int26_6(24<<6 + 47),
 			},
 		},
 		{
 			"text_in_parentheses",
 			&Parenthesis{Term: &Term{Content: []rune{'h', 'e', 'l', 'l', 'o'}}},
-			layoutResult{
+			LayoutResult{
 				Width:  fixed.Int26_6(75<<6 + 42),
 				Height: fixed.Int26_6(39<<6 + 0),
+				Ascent: fixed.Int26_6(26<<6 + 15),
 			},
 		},
 		{
 			"run_in_parentheses",
 			&Parenthesis{Term: &Run{}},
-			layoutResult{
+			LayoutResult{
 				Width:  fixed.Int26_6(21<<6 + 0),
 				Height: fixed.Int26_6(36<<6 + 0),
+				Ascent: fixed.Int26_6(4<<6 + 0),
 			},
 		},
 		{
 			"run",
-			&Run{Terms: []node{&Term{Content: []rune{'h', 'e', 'l', 'l', 'o'}}}},
-			layoutResult{
+			&Run{Terms: []Node{&Term{Content: []rune{'h', 'e', 'l', 'l', 'o'}}}},
+			LayoutResult{
 				Width:  fixed.Int26_6(60<<6 + 44),
 				Height: fixed.Int26_6(29<<6 + 0),
+				Ascent: fixed.Int26_6(24<<6 + 15),
 			},
 		},
 		{
 			"div",
 			&Div{Numerator: &Term{Content: []rune{'1'}}, Denominator: &Term{Content: []rune{'2'}}},
-			layoutResult{
+			LayoutResult{
 				Width:  fixed.Int26_6(21<<6 + 22),
 				Height: fixed.Int26_6(72<<6 + 0),
+				Ascent: fixed.Int26_6(43<<6 + 63),
 			},
 		},
 		{
 			"root",
 			&Root{Term: &Term{Content: []rune{'1'}}},
-			layoutResult{
+			LayoutResult{
 				Width:  fixed.Int26_6(50<<6 + 57),
 				Height: fixed.Int26_6(29<<6 + 0),
+				Ascent: fixed.Int26_6(25<<6 + 15),
+			},
+		},
+		{
+			"sup",
+			&Sup{Base: &Term{Content: []rune{'x'}}, Exponent: &Term{Content: []rune{'2'}}},
+			LayoutResult{
+				Width:  fixed.Int26_6(34<<6 + 22),
+				Height: fixed.Int26_6(31<<6 + 11),
+				Ascent: fixed.Int26_6(27<<6 + 26),
+			},
+		},
+		{
+			"sub",
+			&Sub{Base: &Term{Content: []rune{'x'}}, Index: &Term{Content: []rune{'i'}}, Exponent: &Term{Content: []rune{'2'}}},
+			LayoutResult{
+				Width:  fixed.Int26_6(34<<6 + 22),
+				Height: fixed.Int26_6(36<<6 + 43),
+				Ascent: fixed.Int26_6(27<<6 + 26),
 			},
 		},
 	}
@@ -104,11 +118,12 @@ func TestLayout(t *testing.T) {
 
 	for _, tc := range tcs {
 		t.Run(tc.name, func(t *testing.T) {
-			if err := tc.node.Layout(dc); err != nil {
+			res, err := dc.Layout(tc.node)
+			if err != nil {
 				t.Fatalf("Layout() failed: %v", err)
 			}
-			if *tc.node.Bounds() != tc.results {
-				t.Errorf("results = %v, want %v", tc.node.Bounds(), tc.results)
+			if *res != tc.results {
+				t.Errorf("results = %v, want %v", res, tc.results)
 			}
 		})
 	}
@@ -119,7 +134,7 @@ func TestDraw(t *testing.T) {
 
 	tcs := []struct {
 		name string
-		node node
+		node Node
 	}{
 		{
 			"term",
@@ -132,7 +147,7 @@ func TestDraw(t *testing.T) {
 		{
 			"multi_text_in_parentheses",
 			&Parenthesis{Term: &Run{
-				Terms: []node{
+				Terms: []Node{
 					&Term{Content: []rune{'h', 'e', 'l', 'l', 'o'}},
 					&Term{Content: []rune{'M', 'A', 'T', 'E'}},
 				},
@@ -148,7 +163,7 @@ func TestDraw(t *testing.T) {
 		},
 		{
 			"root_div",
-			&Root{Term: &Run{Terms: []node{
+			&Root{Term: &Run{Terms: []Node{
 				&Div{
 					Numerator:   &Term{Content: []rune{'1'}},
 					Denominator: &Term{Content: []rune{'2', 'a'}},
@@ -157,16 +172,42 @@ func TestDraw(t *testing.T) {
 				&Term{Content: []rune{'3'}},
 			}}},
 		},
+		{
+			"sup",
+			&Run{Terms: []Node{
+				&Sup{
+					Base:     &Term{Content: []rune{'e'}},
+					Exponent: &Term{Content: []rune{'2', 'x'}},
+				},
+				&Term{Content: []rune{'+'}},
+				&Term{Content: []rune{'1'}},
+			}},
+		},
+		{
+			"sub",
+			&Run{Terms: []Node{
+				&Sub{
+					Base:     &Term{Content: []rune{'x'}},
+					Index:    &Term{Content: []rune{'i'}},
+					Exponent: &Term{Content: []rune{'2'}},
+				},
+				&Term{Content: []rune{'+'}},
+				&Sub{
+					Base:  &Term{Content: []rune{'a'}},
+					Index: &Term{Content: []rune{'n', '+', '1'}},
+				},
+			}},
+		},
 	}
 
 	for _, tc := range tcs {
 		t.Run(tc.name, func(t *testing.T) {
-			dc, err := NewContext(truetype.Options{Size: 24})
+			r, err := NewRenderer(truetype.Options{Size: 24}, nil)
 			if err != nil {
 				t.Fatal(err)
 			}
 
-			out, err := dc.DrawRGBA(tc.node, image.NewUniform(color.RGBA{A: 255, R: 255}), image.NewUniform(color.White))
+			out, err := r.DrawRGBA(tc.node, image.NewUniform(color.RGBA{A: 255, R: 255}), image.NewUniform(color.White))
 			if err != nil {
 				t.Fatalf("Draw() failed: %v", err)
 			}
@@ -184,3 +225,434 @@ func TestDraw(t *testing.T) {
 		})
 	}
 }
+
+func TestBaselineAlignment(t *testing.T) {
+	r, err := NewRenderer(truetype.Options{Size: 24}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var rec Recorder
+	n := &Run{Terms: []Node{
+		&Term{Content: []rune{'2'}},
+		&Term{Content: []rune{'+'}},
+		&Div{Numerator: &Term{Content: []rune{'1'}}, Denominator: &Term{Content: []rune{'2'}}},
+		&Term{Content: []rune{'='}},
+		&Sup{Base: &Term{Content: []rune{'x'}}, Exponent: &Term{Content: []rune{'2'}}},
+	}}
+	if err := r.Draw(&rec, n, nil); err != nil {
+		t.Fatalf("Draw() failed: %v", err)
+	}
+
+	// Glyphs outside the fraction and exponent should share a baseline.
+	baseline := rec.Ops[0].Dot.Y
+	for _, i := range []int{1, 5, 6} {
+		if op := rec.Ops[i]; op.Dot.Y != baseline {
+			t.Errorf("glyph %q baseline = %v, want %v", op.Rune, op.Dot.Y, baseline)
+		}
+	}
+	if exp := rec.Ops[7]; exp.Dot.Y >= baseline {
+		t.Errorf("exponent baseline = %v, want above %v", exp.Dot.Y, baseline)
+	}
+
+	// The fraction bar should be centered on the math axis.
+	bar := rec.Ops[3].Rect
+	axis := (baseline - r.newContext().mathAxis()).Round()
+	if mid := (bar.Min.Y + bar.Max.Y) / 2; mid < axis-1 || mid > axis+1 {
+		t.Errorf("fraction bar centered at y=%d, want %d", mid, axis)
+	}
+}
+
+// boxNode is a custom node, drawing a filled square the height of a term.
+type boxNode struct{}
+
+func (b *boxNode) Layout(dc *DrawContext) (*LayoutResult, error) {
+	m := dc.Face(StyleRegular).Metrics()
+	return &LayoutResult{Width: m.Height, Height: m.Height, Ascent: m.Ascent}, nil
+}
+
+func (b *boxNode) Draw(dc *DrawContext, pos fixed.Point26_6, clip image.Rectangle) error {
+	sz := dc.Bounds(b)
+	r := image.Rect(pos.X.Round(), pos.Y.Round(), (pos.X + sz.Width).Round(), (pos.Y + sz.Height).Round())
+	dc.Canvas().FillRect(r, dc.Foreground(), clip)
+	return nil
+}
+
+func TestConstructors(t *testing.T) {
+	built := Seq(
+		Frac(Text("1"), Sqrt(Pow(Text("x"), Text("2")))),
+		Text("+"),
+		Paren(SubSup(Text("a"), Text("i"), Text("2"))),
+		Text("-"),
+		Sum(Text("i"), nil, Integral(Text("0"), Text("1"), Text("x"))),
+		Text("+"),
+		NthRoot(Text("3"), Text("y")),
+	)
+	parsed, err := ParseASCIIEquation("1/sqrt(x^2) + (a_i^2) - sum(i, int(0, 1, x)) + root(3, y)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(Node(built), parsed); diff != "" {
+		t.Errorf("built tree differed from parsed:\n%s", diff)
+	}
+
+	r, err := NewRenderer(truetype.Options{Size: 24}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var rec Recorder
+	if err := r.Draw(&rec, Seq(Text("a"), &boxNode{}), nil); err != nil {
+		t.Fatalf("Draw() failed: %v", err)
+	}
+	if len(rec.Ops) != 2 || rec.Ops[1].Kind != RecordedRect {
+		t.Errorf("ops = %+v, want a glyph and a rect", rec.Ops)
+	}
+}
+
+func TestStretchFace(t *testing.T) {
+	for _, size := range []float64{12, 16.8, 24} {
+		r, err := NewRenderer(truetype.Options{Size: size}, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		dc := r.newContext()
+		for h := fixed.Int26_6(0); h < 160<<6; h += 37 {
+			// The face which linearly probing each size would find.
+			var (
+				want   *Face
+				wantOK bool
+			)
+			for step := 0; size+float64(step) < stretchMaxSize; step++ {
+				want = dc.cache.face(dc.fonts.Symbol, stretchOptions(dc.o, step))
+				if want.Metrics().Height >= h {
+					wantOK = true
+					break
+				}
+			}
+
+			got, ok := dc.stretchFace(h)
+			if ok != wantOK || got.Options != want.Options {
+				t.Errorf("size %v: stretchFace(%v) = %v, %v; want %v, %v", size, h, got.Options.Size, ok, want.Options.Size, wantOK)
+			}
+		}
+	}
+}
+
+func TestFaceCache(t *testing.T) {
+	dc := testContext(t, image.Rect(0, 0, 500, 200))
+	p1 := &Parenthesis{Term: Frac(Text("1"), Text("2"))}
+	p2 := &Parenthesis{Term: Frac(Text("3"), Text("4"))}
+	for _, p := range []*Parenthesis{p1, p2} {
+		if _, err := dc.Layout(p); err != nil {
+			t.Fatalf("Layout() failed: %v", err)
+		}
+	}
+	if dc.states[p1] != dc.states[p2] {
+		t.Error("parentheses of the same size used different faces")
+	}
+
+	// Faces for sizes which are no longer drawn are evicted.
+	c := newFaceCache()
+	first := c.face(dc.fonts.Symbol, truetype.Options{Size: 1})
+	for size := 1.0; size <= 2*maxCachedFaces; size++ {
+		c.face(dc.fonts.Symbol, truetype.Options{Size: size})
+	}
+	if len(c.faces) != maxCachedFaces || c.order.Len() != maxCachedFaces {
+		t.Errorf("cache holds %d faces, want %d", len(c.faces), maxCachedFaces)
+	}
+	if c.face(dc.fonts.Symbol, truetype.Options{Size: 1}) == first {
+		t.Error("least recently used face was not evicted")
+	}
+}
+
+func TestConcurrentDraw(t *testing.T) {
+	n, err := ParseASCIIEquation("(x_i^2 + 1)/sqrt(2a) = y^(n+1)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := NewRenderer(truetype.Options{Size: 24}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sizes := []float64{12, 24, 36}
+	want := make([]*image.RGBA, len(sizes))
+	for i, sz := range sizes {
+		if want[i], err = r.WithSize(sz).DrawRGBA(n, nil, nil); err != nil {
+			t.Fatalf("DrawRGBA() failed: %v", err)
+		}
+	}
+
+	var wg sync.WaitGroup
+	for g := 0; g < 4; g++ {
+		for i, sz := range sizes {
+			wg.Add(1)
+			go func(i int, r *Renderer) {
+				defer wg.Done()
+				out, err := r.DrawRGBA(n, nil, nil)
+				if err != nil {
+					t.Errorf("DrawRGBA() failed: %v", err)
+					return
+				}
+				if !bytes.Equal(out.Pix, want[i].Pix) {
+					t.Errorf("concurrent render at size %v differed", sizes[i])
+				}
+			}(i, r.WithSize(sz))
+		}
+	}
+	wg.Wait()
+}
+
+func TestPadding(t *testing.T) {
+	r, err := NewRenderer(truetype.Options{Size: 24}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	n := Text("x")
+	plain, err := r.Measure(n)
+	if err != nil {
+		t.Fatal(err)
+	}
+	padded, err := r.WithPadding(4).Measure(n)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := image.Rect(0, 0, plain.Dx()+8, plain.Dy()+8); padded != want {
+		t.Errorf("padded bounds = %v, want %v", padded, want)
+	}
+
+	var rec, recPadded Recorder
+	if err := r.Draw(&rec, n, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.WithPadding(4).Draw(&recPadded, n, nil); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := recPadded.Ops[0].Dot, rec.Ops[0].Dot.Add(fixed.P(4, 4)); got != want {
+		t.Errorf("padded glyph drawn at %v, want %v", got, want)
+	}
+}
+
+func TestNilNode(t *testing.T) {
+	r, err := NewRenderer(truetype.Options{Size: 24}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.Measure(nil); err == nil {
+		t.Error("Measure(nil) succeeded, want an error")
+	}
+	if err := r.Draw(&Recorder{}, nil, nil); err == nil {
+		t.Error("Draw(nil) succeeded, want an error")
+	}
+	if _, err := r.DrawRGBA(nil, nil, nil); err == nil {
+		t.Error("DrawRGBA(nil) succeeded, want an error")
+	}
+	if err := r.DrawSVG(&bytes.Buffer{}, nil, nil, nil); err == nil {
+		t.Error("DrawSVG(nil) succeeded, want an error")
+	}
+
+	// Nodes with a missing optional child are drawn, and those missing a
+	// required child return an error.
+	for _, n := range []Node{Sqrt(nil), NthRoot(Text("3"), nil), Paren(nil), Pow(Text("x"), nil)} {
+		if err := r.Draw(&Recorder{}, n, nil); err != nil {
+			t.Errorf("Draw(%#v) failed: %v", n, err)
+		}
+	}
+	for _, n := range []Node{Frac(nil, Text("x")), Pow(nil, Text("2")), Seq(Text("x"), nil)} {
+		if err := r.Draw(&Recorder{}, n, nil); err == nil {
+			t.Errorf("Draw(%#v) succeeded, want an error", n)
+		}
+	}
+}
+
+func TestBigOp(t *testing.T) {
+	r, err := NewRenderer(truetype.Options{Size: 24}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	draw := func(r *Renderer, op rune) []RecordedOp {
+		t.Helper()
+		var rec Recorder
+		n := Seq(Text("y"), Text("="), &BigOp{Op: op, Lower: Text("i"), Upper: Text("n"), Body: Text("i")})
+		if err := r.Draw(&rec, n, nil); err != nil {
+			t.Fatalf("Draw() failed: %v", err)
+		}
+		if len(rec.Ops) != 6 {
+			t.Fatalf("ops = %+v, want 6 glyphs", rec.Ops)
+		}
+		// The body should share the baseline of the terms before it.
+		if body, y := rec.Ops[5], rec.Ops[0]; body.Dot.Y != y.Dot.Y {
+			t.Errorf("body baseline = %v, want %v", body.Dot.Y, y.Dot.Y)
+		}
+		return rec.Ops
+	}
+
+	// In display style, the operator is enlarged and the limits are drawn
+	// above and below it.
+	display := draw(r, OpSum)
+	sum, upper, lower := display[2], display[3], display[4]
+	if sum.Size <= 24 {
+		t.Errorf("display operator size = %v, want larger than 24", sum.Size)
+	}
+	if upper.Size >= 24 || lower.Size >= 24 {
+		t.Errorf("limit sizes = %v, %v; want smaller than 24", upper.Size, lower.Size)
+	}
+	if upper.Dot.X <= sum.Dot.X || lower.Dot.X <= sum.Dot.X {
+		t.Errorf("limits drawn at x = %v, %v; want within the operator at %v", upper.Dot.X, lower.Dot.X, sum.Dot.X)
+	}
+	if upper.Dot.Y >= sum.Dot.Y || lower.Dot.Y <= sum.Dot.Y {
+		t.Errorf("limits drawn at y = %v, %v; want above and below the operator at %v", upper.Dot.Y, lower.Dot.Y, sum.Dot.Y)
+	}
+
+	// In inline style, and for integrals, the limits are drawn beside the
+	// operator.
+	inline := draw(r.WithInline(true), OpSum)
+	if inline[2].Size >= sum.Size {
+		t.Errorf("inline operator size = %v, want smaller than %v", inline[2].Size, sum.Size)
+	}
+	for _, ops := range [][]RecordedOp{inline, draw(r, OpIntegral)} {
+		op, upper, lower := ops[2], ops[3], ops[4]
+		if upper.Dot.X != lower.Dot.X || upper.Dot.X <= op.Dot.X {
+			t.Errorf("%c limits drawn at x = %v, %v; want beside the operator at %v", op.Rune, upper.Dot.X, lower.Dot.X, op.Dot.X)
+		}
+		if upper.Dot.Y >= lower.Dot.Y {
+			t.Errorf("%c upper limit drawn at y = %v, want above %v", op.Rune, upper.Dot.Y, lower.Dot.Y)
+		}
+	}
+
+	// The operator is sized to its body, not to the terms after a relation.
+	opSize := func(eq string) float64 {
+		t.Helper()
+		n, err := ParseLaTeX(eq)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var rec Recorder
+		if err := r.Draw(&rec, n, nil); err != nil {
+			t.Fatalf("Draw() failed: %v", err)
+		}
+		for _, op := range rec.Ops {
+			if op.Rune == OpSum {
+				return op.Size
+			}
+		}
+		t.Fatalf("no operator drawn for %q", eq)
+		return 0
+	}
+	if got, want := opSize(`\sum_{i=1}^{n} i = \frac{n(n+1)}{2}`), opSize(`\sum_{i=1}^{n} i = x`); got != want {
+		t.Errorf("operator size before a fraction = %v, want %v", got, want)
+	}
+
+	// Operators missing from the fonts are errors in strict mode.
+	var merr *MissingGlyphError
+	if _, err := r.WithStrict(true).Measure(&BigOp{Op: '⨁', Body: Text("x")}); !errors.As(err, &merr) || merr.Rune != '⨁' {
+		t.Errorf("Measure() err = %v, want a MissingGlyphError for ⨁", err)
+	}
+}
+
+func TestNthRoot(t *testing.T) {
+	r, err := NewRenderer(truetype.Options{Size: 24}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	draw := func(n Node) map[rune]RecordedOp {
+		t.Helper()
+		var rec Recorder
+		if err := r.Draw(&rec, Seq(Text("y"), Text("="), n), nil); err != nil {
+			t.Fatalf("Draw() failed: %v", err)
+		}
+		out := map[rune]RecordedOp{}
+		for _, op := range rec.Ops {
+			if op.Kind == RecordedGlyph {
+				out[op.Rune] = op
+			}
+		}
+		return out
+	}
+
+	// The index is drawn at script size, up and to the left of the surd,
+	// and the radicand stays on the baseline.
+	sqrt, cube := draw(Sqrt(Text("x"))), draw(NthRoot(Text("3"), Text("x")))
+	index, surd := cube['3'], cube[surdChar]
+	if index.Size >= 24 {
+		t.Errorf("index size = %v, want smaller than 24", index.Size)
+	}
+	if index.Dot.X >= surd.Dot.X+fixed.I(int(surd.Size)/2) {
+		t.Errorf("index drawn at x = %v, want within the left of the surd at %v", index.Dot.X, surd.Dot.X)
+	}
+	if index.Dot.Y >= cube['x'].Dot.Y {
+		t.Errorf("index drawn at y = %v, want above the baseline at %v", index.Dot.Y, cube['x'].Dot.Y)
+	}
+	if got, want := cube['x'].Dot.Y, cube['y'].Dot.Y; got != want {
+		t.Errorf("radicand baseline = %v, want %v", got, want)
+	}
+
+	// A wide index moves the surd right to make room for it.
+	wide := draw(NthRoot(Text("n+1"), Text("x")))
+	if wide[surdChar].Dot.X <= sqrt[surdChar].Dot.X {
+		t.Errorf("surd drawn at x = %v, want right of %v", wide[surdChar].Dot.X, sqrt[surdChar].Dot.X)
+	}
+	if wide['n'].Dot.X < sqrt['='].Dot.X {
+		t.Errorf("index drawn at x = %v, want right of the preceding terms at %v", wide['n'].Dot.X, sqrt['='].Dot.X)
+	}
+}
+
+func TestMatrix(t *testing.T) {
+	r, err := NewRenderer(truetype.Options{Size: 24}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := &Matrix{
+		Rows: [][]Node{
+			{Text("1"), Text("x")},
+			{Text("100"), Text("xyz")},
+		},
+		Align:  []Alignment{AlignLeft, AlignRight},
+		Delims: DelimParens,
+	}
+	var rec Recorder
+	if err := r.Draw(&rec, Seq(Text("A"), Text("="), m), nil); err != nil {
+		t.Fatalf("Draw() failed: %v", err)
+	}
+	if len(rec.Ops) != 12 {
+		t.Fatalf("ops = %+v, want 12 glyphs", rec.Ops)
+	}
+	// The glyphs are the terms before the matrix, its delimiters, and its
+	// cells in order.
+	eq, open, close, one, x, hundred, xyz := rec.Ops[0], rec.Ops[2], rec.Ops[3], rec.Ops[4], rec.Ops[5], rec.Ops[6], rec.Ops[9]
+
+	if open.Size <= 24 || close.Size != open.Size {
+		t.Errorf("delimiter sizes = %v, %v; want equal and larger than 24", open.Size, close.Size)
+	}
+	if one.Dot.X != hundred.Dot.X {
+		t.Errorf("left aligned cells drawn at x = %v, %v; want equal", one.Dot.X, hundred.Dot.X)
+	}
+	if x.Dot.X <= xyz.Dot.X {
+		t.Errorf("right aligned cells drawn at x = %v, %v; want the shorter further right", x.Dot.X, xyz.Dot.X)
+	}
+	if hundred.Dot.Y <= one.Dot.Y || x.Dot.Y != one.Dot.Y {
+		t.Errorf("rows drawn at y = %v, %v; want the second below the first", one.Dot.Y, hundred.Dot.Y)
+	}
+
+	// The rows should be centered on the math axis, give or take the
+	// difference between their ascent and descent.
+	axis := eq.Dot.Y - r.newContext().mathAxis()
+	if mid := (one.Dot.Y + hundred.Dot.Y) / 2; mid < axis || mid > axis+12<<6 {
+		t.Errorf("rows centered at y = %v, want near the math axis at %v", mid, axis)
+	}
+
+	// Wider gaps make the matrix larger.
+	plain, err := r.Measure(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	spaced := *m
+	spaced.RowGap, spaced.ColumnGap = 2, 3
+	wide, err := r.Measure(&spaced)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if wide.Dx() <= plain.Dx() || wide.Dy() <= plain.Dy() {
+		t.Errorf("spaced bounds = %v, want larger than %v", wide, plain)
+	}
+}
@@ -1,17 +1,49 @@
 package eqdraw
 
 import (
+	"embed"
 	"errors"
 	"fmt"
 	"io/ioutil"
 	"os"
 	"os/user"
+	"path"
 	"path/filepath"
 	"strings"
+	"sync"
 
 	"github.com/golang/freetype/truetype"
 )
 
+// embeddedFonts contains the bundled Liberation Sans fonts, so the default
+// fonts are always available regardless of the working directory.
+//
+//go:embed liberationsans/*.ttf
+var embeddedFonts embed.FS
+
+// embeddedFont is one of the bundled fonts, which is parsed on first use
+// and then shared by every caller.
+type embeddedFont struct {
+	name string
+	once sync.Once
+	font *truetype.Font
+	err  error
+}
+
+func (e *embeddedFont) load() (*truetype.Font, error) {
+	e.once.Do(func() {
+		e.font, e.err = loadEmbeddedFont(e.name)
+	})
+	return e.font, e.err
+}
+
+var (
+	fontRegular    = &embeddedFont{name: "LiberationSans-Regular.ttf"}
+	fontItalic     = &embeddedFont{name: "LiberationSans-Italic.ttf"}
+	fontBold       = &embeddedFont{name: "LiberationSans-Bold.ttf"}
+	fontBoldItalic = &embeddedFont{name: "LiberationSans-BoldItalic.ttf"}
+)
+
 func findFontPath(base string) (string, error) {
 	u, err := user.Current()
 	if err != nil {
@@ -35,24 +67,61 @@ func findFontPath(base string) (string, error) {
 	return "", errors.New("could not find font: " + base)
 }
 
-// DefaultFontRegular returns the default font to use.
+// DefaultFontRegular returns the default font to use. The font is parsed
+// once, and the same font is returned by each call.
 func DefaultFontRegular() (*truetype.Font, error) {
-	return loadFont("LiberationSans-Regular.ttf")
+	return fontRegular.load()
 }
 
 // DefaultFontItalic returns the default font to use for italic.
 func DefaultFontItalic() (*truetype.Font, error) {
-	return loadFont("LiberationSans-Italic.ttf")
+	return fontItalic.load()
+}
+
+func loadEmbeddedFont(f string) (*truetype.Font, error) {
+	d, err := embeddedFonts.ReadFile(path.Join("liberationsans", f))
+	if err != nil {
+		return nil, fmt.Errorf("reading font: %w", err)
+	}
+	return truetype.Parse(d)
 }
 
-func loadFont(f string) (*truetype.Font, error) {
+// SystemFont loads the named font file from the filesystem, searching the
+// current directory, the liberationsans directory, and the system font
+// directories. It can be used to override the embedded default fonts with
+// locally installed versions.
+func SystemFont(f string) (*truetype.Font, error) {
 	p, err := findFontPath(f)
 	if err != nil {
 		return nil, fmt.Errorf("finding font: %w", err)
 	}
+	return FontFromFile(p)
+}
+
+// DefaultFontBold returns the default font to use for bold.
+func DefaultFontBold() (*truetype.Font, error) {
+	return fontBold.load()
+}
+
+// DefaultFontBoldItalic returns the default font to use for bold italic.
+func DefaultFontBoldItalic() (*truetype.Font, error) {
+	return fontBoldItalic.load()
+}
+
+// FontFromFile loads a TrueType font from the file at the given path.
+func FontFromFile(p string) (*truetype.Font, error) {
 	d, err := ioutil.ReadFile(p)
 	if err != nil {
 		return nil, fmt.Errorf("reading font: %w", err)
 	}
-	return truetype.Parse(d)
+	return FontFromBytes(d)
+}
+
+// FontFromBytes parses a TrueType font from its encoded bytes.
+func FontFromBytes(d []byte) (*truetype.Font, error) {
+	f, err := truetype.Parse(d)
+	if err != nil {
+		return nil, fmt.Errorf("parsing font: %w", err)
+	}
+	return f, nil
 }
@@ -0,0 +1,122 @@
+package eqdraw
+
+import (
+	"os"
+	"testing"
+
+	"github.com/golang/freetype/truetype"
+	"github.com/google/go-cmp/cmp"
+	"golang.org/x/image/font/gofont/goregular"
+	"golang.org/x/image/math/fixed"
+)
+
+func TestDefaultFontsEmbedded(t *testing.T) {
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Move away from the package directory, so the bundled fonts cannot be
+	// found on the filesystem.
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+
+	for name, load := range map[string]func() (*truetype.Font, error){
+		"regular":     DefaultFontRegular,
+		"italic":      DefaultFontItalic,
+		"bold":        DefaultFontBold,
+		"bold italic": DefaultFontBoldItalic,
+	} {
+		f, err := load()
+		if err != nil {
+			t.Errorf("loading %s font failed: %v", name, err)
+			continue
+		}
+		// The font should only be parsed once.
+		if again, _ := load(); again != f {
+			t.Errorf("loading %s font again returned a different font", name)
+		}
+	}
+}
+
+func TestFontSet(t *testing.T) {
+	bold, err := FontFromFile("liberationsans/LiberationSans-Bold.ttf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewRenderer(truetype.Options{Size: 24}, &FontSet{Italic: bold}); err == nil {
+		t.Error("NewRenderer() with no regular font succeeded, want error")
+	}
+
+	def, err := NewRenderer(truetype.Options{Size: 24}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	boldOnly, err := NewRenderer(truetype.Options{Size: 24}, &FontSet{Regular: bold})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	width := func(r *Renderer, n *Term) fixed.Int26_6 {
+		sz, err := r.newContext().Layout(n)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return sz.Width
+	}
+	var (
+		auto     = &Term{Content: []rune("MATE")}
+		boldTerm = &Term{Content: []rune("MATE"), Style: StyleBold}
+	)
+	if w, bw := width(def, auto), width(def, boldTerm); w >= bw {
+		t.Errorf("regular width %v >= bold width %v", w, bw)
+	}
+	// All styles fall back to the only font in the set.
+	if w, bw := width(boldOnly, auto), width(def, boldTerm); w != bw {
+		t.Errorf("fallback width = %v, want %v", w, bw)
+	}
+}
+
+func TestFallbackFonts(t *testing.T) {
+	goRegular, err := FontFromBytes(goregular.TTF)
+	if err != nil {
+		t.Fatal(err)
+	}
+	liberation, err := DefaultFontRegular()
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := NewRenderer(truetype.Options{Size: 24}, &FontSet{
+		Regular:  goRegular,
+		Fallback: []*truetype.Font{liberation},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 'ƀ' is missing from the Go fonts, so should be drawn from the fallback.
+	var rec Recorder
+	if err := r.Draw(&rec, &Term{Content: []rune("1ƀ")}, nil); err != nil {
+		t.Fatalf("Draw() failed: %v", err)
+	}
+	if len(rec.Ops) != 2 {
+		t.Fatalf("got %d ops, want 2", len(rec.Ops))
+	}
+	if rec.Ops[0].Font != goRegular {
+		t.Error("'1' was not drawn with the primary font")
+	}
+	if rec.Ops[1].Font != liberation {
+		t.Error("'ƀ' was not drawn with the fallback font")
+	}
+
+	strict := r.WithStrict(true)
+	if _, err := strict.newContext().Layout(&Term{Content: []rune("1ƀ")}); err != nil {
+		t.Errorf("strict Layout() failed: %v", err)
+	}
+	_, err = strict.newContext().Layout(&Term{Content: []rune("a∇b")})
+	want := &MissingGlyphError{Rune: '∇', Pos: 1, Term: "a∇b"}
+	if diff := cmp.Diff(err, error(want)); diff != "" {
+		t.Errorf("strict Layout() err differed:\n%s", diff)
+	}
+}
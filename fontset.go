@@ -0,0 +1,95 @@
+package eqdraw
+
+import (
+	"errors"
+
+	"github.com/golang/freetype/truetype"
+)
+
+// FontStyle selects which font from a FontSet a term is drawn with.
+type FontStyle uint8
+
+// Valid FontStyle values.
+const (
+	// StyleAuto draws latin lowercase letters in italic, and everything
+	// else upright.
+	StyleAuto FontStyle = iota
+	StyleRegular
+	StyleItalic
+	StyleBold
+	StyleBoldItalic
+)
+
+// faceSymbol is the index of the symbol face within DrawContext.faces.
+const faceSymbol = StyleBoldItalic + 1
+
+// FontSet is the collection of fonts equations are drawn with.
+type FontSet struct {
+	Regular    *truetype.Font
+	Italic     *truetype.Font
+	Bold       *truetype.Font
+	BoldItalic *truetype.Font
+	// Symbol is used to draw the stretched symbols of nodes, such as
+	// parentheses and surds.
+	Symbol *truetype.Font
+	// Fallback fonts are consulted in order for any rune which is missing
+	// from the font a term would otherwise be drawn with.
+	Fallback []*truetype.Font
+}
+
+// DefaultFontSet returns the bundled Liberation Sans fonts.
+func DefaultFontSet() (*FontSet, error) {
+	var (
+		fs  FontSet
+		err error
+	)
+	if fs.Regular, err = DefaultFontRegular(); err != nil {
+		return nil, err
+	}
+	if fs.Italic, err = DefaultFontItalic(); err != nil {
+		return nil, err
+	}
+	if fs.Bold, err = DefaultFontBold(); err != nil {
+		return nil, err
+	}
+	if fs.BoldItalic, err = DefaultFontBoldItalic(); err != nil {
+		return nil, err
+	}
+	fs.Symbol = fs.Regular
+	return &fs, nil
+}
+
+// complete returns a copy of the font set, where missing fonts are
+// substituted with the closest font that is present.
+func (fs FontSet) complete() (FontSet, error) {
+	if fs.Regular == nil {
+		return fs, errors.New("font set has no regular font")
+	}
+	if fs.Italic == nil {
+		fs.Italic = fs.Regular
+	}
+	if fs.Bold == nil {
+		fs.Bold = fs.Regular
+	}
+	if fs.BoldItalic == nil {
+		fs.BoldItalic = fs.Bold
+	}
+	if fs.Symbol == nil {
+		fs.Symbol = fs.Regular
+	}
+	return fs, nil
+}
+
+// font returns the font for the given style. StyleAuto is treated as
+// StyleRegular.
+func (fs *FontSet) font(s FontStyle) *truetype.Font {
+	switch s {
+	case StyleItalic:
+		return fs.Italic
+	case StyleBold:
+		return fs.Bold
+	case StyleBoldItalic:
+		return fs.BoldItalic
+	}
+	return fs.Regular
+}
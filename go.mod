@@ -1,6 +1,6 @@
 module github.com/twitchyliquid64/eqdraw
 
-go 1.13
+go 1.16
 
 require (
 	github.com/golang/freetype v0.0.0-20170609003504-e2365dfdc4a0
@@ -0,0 +1,758 @@
+package eqdraw
+
+import (
+	"fmt"
+	"unicode"
+)
+
+// latexSymbols maps commands for ordinary symbols to the rune drawn.
+var latexSymbols = map[string]rune{
+	"alpha": 'α', "beta": 'β', "gamma": 'γ', "delta": 'δ', "epsilon": 'ϵ',
+	"varepsilon": 'ε', "zeta": 'ζ', "eta": 'η', "theta": 'θ', "vartheta": 'ϑ',
+	"iota": 'ι', "kappa": 'κ', "lambda": 'λ', "mu": 'μ', "nu": 'ν', "xi": 'ξ',
+	"pi": 'π', "rho": 'ρ', "sigma": 'σ', "tau": 'τ', "upsilon": 'υ',
+	"phi": 'ϕ', "varphi": 'φ', "chi": 'χ', "psi": 'ψ', "omega": 'ω',
+	"Gamma": 'Γ', "Delta": 'Δ', "Theta": 'Θ', "Lambda": 'Λ', "Xi": 'Ξ',
+	"Pi": 'Π', "Sigma": 'Σ', "Upsilon": 'Υ', "Phi": 'Φ', "Psi": 'Ψ',
+	"Omega": 'Ω',
+	"infty": '∞', "partial": '∂', "nabla": '∇', "ell": 'ℓ', "hbar": 'ħ',
+	"ldots": '…', "cdots": '⋯', "prime": '′', "backslash": '\\',
+}
+
+// latexOperators maps commands for binary operators and relations to the
+// rune drawn.
+var latexOperators = map[string]rune{
+	"cdot": '·', "times": '×', "div": '÷', "pm": '±', "mp": '∓',
+	"le": '≤', "leq": '≤', "ge": '≥', "geq": '≥', "ne": '≠', "neq": '≠',
+	"approx": '≈', "equiv": '≡', "sim": '∼', "propto": '∝',
+	"to": '→', "rightarrow": '→', "leftarrow": '←', "Rightarrow": '⇒',
+	"Leftarrow": '⇐', "leftrightarrow": '↔', "Leftrightarrow": '⇔',
+	"in": '∈', "notin": '∉', "subset": '⊂', "subseteq": '⊆', "cup": '∪',
+	"cap": '∩', "forall": '∀', "exists": '∃', "neg": '¬', "wedge": '∧',
+	"vee": '∨', "circ": '∘',
+}
+
+// latexBigOps maps commands for large operators to the operator drawn.
+var latexBigOps = map[string]rune{
+	"sum": OpSum, "prod": OpProduct, "coprod": OpCoproduct, "int": OpIntegral,
+	"oint": OpContourIntegral, "iint": '∬', "iiint": '∭', "bigcup": '⋃',
+	"bigcap": '⋂',
+}
+
+// latexMatrices maps the environments which draw a matrix to the
+// delimiters drawn around it.
+var latexMatrices = map[string]Delimiter{
+	"matrix": DelimNone, "array": DelimNone, "pmatrix": DelimParens,
+	"bmatrix": DelimBrackets, "Bmatrix": DelimBraces, "vmatrix": DelimBars,
+	"Vmatrix": DelimDoubleBars,
+}
+
+// latexAlignments maps the column specifiers of an array environment to
+// the alignment of the column.
+var latexAlignments = map[rune]Alignment{
+	'l': AlignLeft, 'c': AlignCenter, 'r': AlignRight,
+}
+
+// latexFunctions are the commands which typeset the name of a function.
+var latexFunctions = map[string]bool{
+	"sin": true, "cos": true, "tan": true, "sec": true, "csc": true, "cot": true,
+	"arcsin": true, "arccos": true, "arctan": true, "sinh": true, "cosh": true,
+	"tanh": true, "log": true, "ln": true, "exp": true, "lim": true, "min": true,
+	"max": true, "sup": true, "inf": true, "det": true, "gcd": true,
+}
+
+// latexText maps the commands whose argument is rendered verbatim as a
+// term, to the style of the term.
+var latexText = map[string]FontStyle{
+	"text": StyleRegular, "textrm": StyleRegular, "mathrm": StyleRegular,
+	"operatorname": StyleRegular, "mathit": StyleItalic, "mathbf": StyleBold,
+	"textbf": StyleBold, "textit": StyleItalic, "boldsymbol": StyleBoldItalic,
+}
+
+// latexSpaces are the spacing commands, which are ignored.
+var latexSpaces = map[string]bool{
+	",": true, ":": true, ";": true, "!": true, " ": true, "quad": true,
+	"qquad": true, "displaystyle": true, "textstyle": true, "limits": true,
+	"nolimits": true,
+}
+
+type latexParser struct {
+	in  []rune
+	pos int
+	// env is the number of environments the parser is within.
+	env int
+	// opt is the number of optional arguments, such as the index of a
+	// root, the parser is within.
+	opt int
+}
+
+// errorf returns a ParseError for the input from the rune index start, up
+// to end.
+func (p *latexParser) errorf(kind ErrorKind, start, end int, format string, args ...interface{}) error {
+	if end > len(p.in) {
+		end = len(p.in)
+	}
+	return &ParseError{
+		Pos:    start + 1,
+		Offset: len(string(p.in[:start])),
+		Len:    end - start,
+		Kind:   kind,
+		Msg:    fmt.Sprintf(format, args...),
+	}
+}
+
+func (p *latexParser) done() bool {
+	return p.pos >= len(p.in)
+}
+
+func (p *latexParser) peek() rune {
+	if p.done() {
+		return -1
+	}
+	return p.in[p.pos]
+}
+
+func (p *latexParser) skipSpace() {
+	for !p.done() && unicode.IsSpace(p.in[p.pos]) {
+		p.pos++
+	}
+}
+
+// peekCommand returns the name of the command at the current position,
+// without consuming it.
+func (p *latexParser) peekCommand() string {
+	if p.peek() != '\\' || p.pos+1 >= len(p.in) {
+		return ""
+	}
+	end := p.pos + 1
+	for end < len(p.in) && isLaTeXLetter(p.in[end]) {
+		end++
+	}
+	if end == p.pos+1 {
+		// Single, non-letter command such as \, or \{.
+		end++
+	}
+	return string(p.in[p.pos+1 : end])
+}
+
+// readCommand consumes the command at the current position, returning its
+// name.
+func (p *latexParser) readCommand() string {
+	name := p.peekCommand()
+	p.pos += 1 + len([]rune(name))
+	return name
+}
+
+// atClose returns true if the parser is positioned at the end of a
+// sequence. Within an environment, sequences also end at the end of each
+// cell, and within an optional argument at its closing ']'.
+func (p *latexParser) atClose() bool {
+	switch p.peek() {
+	case '}':
+		return true
+	case ']':
+		return p.opt > 0
+	case '&':
+		return p.env > 0
+	case '\\':
+		switch p.peekCommand() {
+		case "right":
+			return true
+		case "\\", "end":
+			return p.env > 0
+		}
+	}
+	return false
+}
+
+// atRelation returns true if the parser is positioned at a relation, such
+// as '=' or \le.
+func (p *latexParser) atRelation() bool {
+	if c := p.peek(); c != '\\' {
+		return isRelation(c)
+	}
+	r, ok := latexOperators[p.peekCommand()]
+	return ok && isRelation(r)
+}
+
+// parseSeq parses a sequence of atoms, until the end of input or a closing
+// '}' or \right is reached. The closing token is not consumed.
+func (p *latexParser) parseSeq() ([]Node, error) {
+	return p.parseTerms(false, false)
+}
+
+// parseTerms parses a sequence of atoms like parseSeq. Bare parentheses are
+// ordinary terms, as in [0, 1), but a matching pair of them within the
+// sequence is grouped into a Parenthesis. If paren is true, the sequence
+// also ends at a ')' which it did not open, and if body is true, at a
+// relation outside any parentheses it opened.
+func (p *latexParser) parseTerms(paren, body bool) ([]Node, error) {
+	var (
+		out   []Node
+		opens []int // Indices in out of the unmatched '(' terms.
+	)
+	for {
+		p.skipSpace()
+		if p.done() || p.atClose() {
+			return out, nil
+		}
+		if len(opens) == 0 && ((paren && p.peek() == ')') || (body && p.atRelation())) {
+			return out, nil
+		}
+
+		if op, ok := latexBigOps[p.peekCommand()]; ok {
+			n, err := p.parseBigOp(op, paren || len(opens) > 0)
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, n)
+			continue
+		}
+
+		c, left := p.peek(), p.peekCommand() == "left"
+		n, err := p.parseAtom()
+		if err != nil {
+			return nil, err
+		}
+		if n == nil {
+			continue
+		}
+		if c == ')' && len(opens) > 0 {
+			i := opens[len(opens)-1]
+			opens = opens[:len(opens)-1]
+			n = &Parenthesis{Term: seqNode(out[i+1:])}
+			out = out[:i]
+		}
+		if n, err = p.parseScripts(n); err != nil {
+			return nil, err
+		}
+		if _, ok := n.(*Term); ok && c == '(' {
+			opens = append(opens, len(out))
+		}
+		if r, ok := n.(*Run); ok && left {
+			// Delimiters drawn as terms join the sequence, unless they
+			// have scripts.
+			out = append(out, r.Terms...)
+			continue
+		}
+		out = append(out, n)
+	}
+}
+
+// parseBigOp parses a large operator and its limits. The rest of the
+// sequence, up to the next relation, is the body of the operator. If paren
+// is true, the body also ends at a ')'.
+func (p *latexParser) parseBigOp(op rune, paren bool) (Node, error) {
+	p.readCommand()
+	for {
+		p.skipSpace()
+		if name := p.peekCommand(); name != "limits" && name != "nolimits" {
+			break
+		}
+		p.readCommand()
+	}
+	upper, lower, err := p.parseScriptArgs()
+	if err != nil {
+		return nil, err
+	}
+	body, err := p.parseTerms(paren, true)
+	if err != nil {
+		return nil, err
+	}
+	return &BigOp{Op: op, Lower: lower, Upper: upper, Body: seqNode(body)}, nil
+}
+
+// expectClose consumes the closing token of a sequence started at the given
+// position, returning an error if it is not the rune c.
+func (p *latexParser) expectClose(c rune, start int, what string) error {
+	if p.peek() == c {
+		p.pos++
+		return nil
+	}
+	if p.done() {
+		return p.errorf(KindUnmatched, start, start+1, "unmatched %s", what)
+	}
+	return p.errorf(KindUnexpected, p.pos, p.pos+1, "unexpected %q", p.peek())
+}
+
+// parseGroup parses the contents of a {} group. Brackets within the group
+// do not close an optional argument around it.
+func (p *latexParser) parseGroup() (Node, error) {
+	start := p.pos
+	p.pos++
+	opt := p.opt
+	p.opt = 0
+	terms, err := p.parseSeq()
+	p.opt = opt
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expectClose('}', start, "start brace"); err != nil {
+		return nil, err
+	}
+	return seqNode(terms), nil
+}
+
+// parseOptArg parses the optional argument to a command, written in
+// brackets, returning nil if there is none.
+func (p *latexParser) parseOptArg() (Node, error) {
+	p.skipSpace()
+	if p.peek() != '[' {
+		return nil, nil
+	}
+	start := p.pos
+	p.pos++
+	p.opt++
+	terms, err := p.parseSeq()
+	p.opt--
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expectClose(']', start, "start bracket"); err != nil {
+		return nil, err
+	}
+	return seqNode(terms), nil
+}
+
+// parseArg parses the argument to a command, or a superscript or
+// subscript. Unless braced, the argument is a single character or command.
+func (p *latexParser) parseArg() (Node, error) {
+	p.skipSpace()
+	start := p.pos
+	var (
+		n   Node
+		err error
+	)
+	switch c := p.peek(); {
+	case c == '{':
+		n, err = p.parseGroup()
+	case c == '\\':
+		n, err = p.parseCommand()
+	case c < 0 || c == '}' || c == '^' || c == '_':
+		return nil, p.errorf(KindMissingOperand, start, start+1, "missing argument")
+	default:
+		p.pos++
+		n = &Term{Content: []rune{c}}
+	}
+	if err != nil {
+		return nil, err
+	}
+	if n == nil {
+		return nil, p.errorf(KindMissingOperand, start, p.pos, "missing argument")
+	}
+	return n, nil
+}
+
+// parseScripts parses any superscript or subscript following base.
+func (p *latexParser) parseScripts(base Node) (Node, error) {
+	sup, sub, err := p.parseScriptArgs()
+	if err != nil {
+		return nil, err
+	}
+	return scriptNode(base, sup, sub), nil
+}
+
+// parseScriptArgs parses any superscript or subscript, returning nil for
+// those which are absent.
+func (p *latexParser) parseScriptArgs() (sup, sub Node, err error) {
+	for {
+		p.skipSpace()
+		c := p.peek()
+		if c != '^' && c != '_' {
+			break
+		}
+		start := p.pos
+		p.pos++
+		arg, err := p.parseArg()
+		if err != nil {
+			return nil, nil, err
+		}
+
+		switch {
+		case c == '^' && sup != nil:
+			return nil, nil, p.errorf(KindUnexpected, start, start+1, "double superscript")
+		case c == '_' && sub != nil:
+			return nil, nil, p.errorf(KindUnexpected, start, start+1, "double subscript")
+		case c == '^':
+			sup = arg
+		default:
+			sub = arg
+		}
+	}
+	return sup, sub, nil
+}
+
+// parseAtom parses a single term, group or command. A nil node is returned
+// for input which draws nothing, such as spacing commands.
+func (p *latexParser) parseAtom() (Node, error) {
+	start := p.pos
+	switch c := p.peek(); {
+	case c == '{':
+		return p.parseGroup()
+
+	case c == '\\':
+		return p.parseCommand()
+
+	case c == '^' || c == '_':
+		return nil, p.errorf(KindMissingOperand, start, start+1, "missing base for %q", c)
+
+	case c == '~':
+		p.pos++
+		return nil, nil
+
+	case c == '&' || c == '$' || c == '#' || c == '%':
+		return nil, p.errorf(KindUnsupported, start, start+1, "unsupported character %q", c)
+
+	case isLaTeXOperator(c):
+		p.pos++
+		return &Term{Content: []rune{c}}, nil
+	}
+
+	for !p.done() && isLaTeXOrdinary(p.peek()) {
+		p.pos++
+	}
+	return &Term{Content: append([]rune{}, p.in[start:p.pos]...)}, nil
+}
+
+// parseCommand parses a command, and any arguments it takes.
+func (p *latexParser) parseCommand() (Node, error) {
+	start := p.pos
+	name := p.readCommand()
+
+	switch name {
+	case "":
+		return nil, p.errorf(KindUnexpected, start, start+1, "missing command name")
+
+	case "frac", "dfrac", "tfrac":
+		num, err := p.parseArg()
+		if err != nil {
+			return nil, err
+		}
+		den, err := p.parseArg()
+		if err != nil {
+			return nil, err
+		}
+		return &Div{Numerator: num, Denominator: den}, nil
+
+	case "sqrt":
+		index, err := p.parseOptArg()
+		if err != nil {
+			return nil, err
+		}
+		t, err := p.parseArg()
+		if err != nil {
+			return nil, err
+		}
+		return &Root{Term: t, Index: index}, nil
+
+	case "begin":
+		return p.parseEnv(start)
+
+	case "left":
+		open, err := p.parseDelim(start, "left")
+		if err != nil {
+			return nil, err
+		}
+		terms, err := p.parseSeq()
+		if err != nil {
+			return nil, err
+		}
+		if p.peekCommand() != "right" {
+			if p.done() {
+				return nil, p.errorf(KindUnmatched, start, start+len(`\left`), "unmatched \\left")
+			}
+			return nil, p.errorf(KindUnexpected, p.pos, p.pos+1, "unexpected %q", p.peek())
+		}
+		rightPos := p.pos
+		p.readCommand()
+		close, err := p.parseDelim(rightPos, "right")
+		if err != nil {
+			return nil, err
+		}
+		return delimited(open, close, terms), nil
+
+	case "{", "}", "%", "$", "&", "#", "_":
+		return &Term{Content: []rune(name)}, nil
+	}
+
+	if latexSpaces[name] {
+		return nil, nil
+	}
+	if latexFunctions[name] {
+		return &Term{Content: []rune(name), Style: StyleRegular}, nil
+	}
+	if r, ok := latexSymbols[name]; ok {
+		return &Term{Content: []rune{r}}, nil
+	}
+	if r, ok := latexOperators[name]; ok {
+		return &Term{Content: []rune{r}}, nil
+	}
+	if r, ok := latexBigOps[name]; ok {
+		// A large operator outside a sequence, such as in a script, has no
+		// body or limits.
+		return &Term{Content: []rune{r}}, nil
+	}
+	if style, ok := latexText[name]; ok {
+		return p.parseText(start, name, style)
+	}
+	return nil, p.errorf(KindUnsupported, start, p.pos, "unknown command \\%s", name)
+}
+
+// parseDelim parses the delimiter following \left or \right, which started
+// at the rune index start, returning the rune it draws. The empty delimiter,
+// '.', is returned as 0.
+func (p *latexParser) parseDelim(start int, cmd string) (rune, error) {
+	p.skipSpace()
+	switch c := p.peek(); c {
+	case '.':
+		p.pos++
+		return 0, nil
+	case '(', ')', '[', ']', '|':
+		p.pos++
+		return c, nil
+	case '\\':
+		switch p.peekCommand() {
+		case "{", "}":
+			return []rune(p.readCommand())[0], nil
+		case "|":
+			p.readCommand()
+			return '‖', nil
+		}
+	}
+	return 0, p.errorf(KindUnsupported, start, p.pos+1, "unsupported delimiter after \\%s", cmd)
+}
+
+// delimited returns the node for the terms between \left and \right
+// delimiters. A matrix alone between them takes the delimiters, as does the
+// content of a \left( \right) pair. Other delimiters are drawn as terms,
+// except empty delimiters, which are 0 and draw nothing.
+func delimited(open, close rune, terms []Node) Node {
+	n := seqNode(terms)
+	if m, ok := n.(*Matrix); ok && m.Delims == DelimNone {
+		for d := range latexDelims {
+			if o, c := d.runes(); o == open && c == close {
+				m.Delims = d
+				return m
+			}
+		}
+	}
+	if open == '(' && close == ')' {
+		return &Parenthesis{Term: n}
+	}
+	var out []Node
+	if open != 0 {
+		out = append(out, &Term{Content: []rune{open}})
+	}
+	out = append(out, terms...)
+	if close != 0 {
+		out = append(out, &Term{Content: []rune{close}})
+	}
+	return seqNode(out)
+}
+
+// readName reads the braced name following a command, such as the name of
+// an environment.
+func (p *latexParser) readName(cmd string) (string, error) {
+	p.skipSpace()
+	if p.peek() != '{' {
+		return "", p.errorf(KindUnexpected, p.pos, p.pos+1, "expected { after \\%s", cmd)
+	}
+	start := p.pos
+	for !p.done() && p.peek() != '}' {
+		p.pos++
+	}
+	if p.done() {
+		return "", p.errorf(KindUnmatched, start, start+1, "unmatched start brace")
+	}
+	p.pos++
+	return string(p.in[start+1 : p.pos-1]), nil
+}
+
+// parseEnv parses an environment, following \begin at the rune index
+// start. Only the environments which draw a matrix are supported.
+func (p *latexParser) parseEnv(start int) (Node, error) {
+	name, err := p.readName("begin")
+	if err != nil {
+		return nil, err
+	}
+	delims, ok := latexMatrices[name]
+	if !ok {
+		return nil, p.errorf(KindUnsupported, start, p.pos, "unsupported environment %s", name)
+	}
+	out := &Matrix{Delims: delims}
+
+	if name == "array" {
+		specStart := p.pos
+		spec, err := p.readName(name)
+		if err != nil {
+			return nil, err
+		}
+		for _, c := range spec {
+			a, ok := latexAlignments[c]
+			if !ok && !unicode.IsSpace(c) {
+				return nil, p.errorf(KindUnsupported, specStart, p.pos, "unsupported column specifier %q", c)
+			}
+			if ok {
+				out.Align = append(out.Align, a)
+			}
+		}
+	}
+
+	p.env++
+	defer func() { p.env-- }()
+	var row []Node
+	for {
+		terms, err := p.parseSeq()
+		if err != nil {
+			return nil, err
+		}
+		row = append(row, seqNode(terms))
+
+		switch cmdStart := p.pos; {
+		case p.peek() == '&':
+			p.pos++
+		case p.peekCommand() == "\\":
+			p.readCommand()
+			out.Rows, row = append(out.Rows, row), nil
+		case p.peekCommand() == "end":
+			p.readCommand()
+			end, err := p.readName("end")
+			if err != nil {
+				return nil, err
+			}
+			if end != name {
+				return nil, p.errorf(KindUnexpected, cmdStart, p.pos, "\\end{%s} does not match \\begin{%s}", end, name)
+			}
+			// A line break after the last row does not start another.
+			if len(row) > 1 || row[0] != nil || len(out.Rows) == 0 {
+				out.Rows = append(out.Rows, row)
+			}
+			return out, nil
+		case p.done():
+			return nil, p.errorf(KindUnmatched, start, start+len(`\begin`), "unmatched \\begin{%s}", name)
+		default:
+			return nil, p.errorf(KindUnexpected, p.pos, p.pos+1, "unexpected %q", p.peek())
+		}
+	}
+}
+
+// parseText parses the braced argument of a text command verbatim, apart
+// from the characters escaped as escapeLaTeXText writes them, such as \%.
+func (p *latexParser) parseText(start int, name string, style FontStyle) (Node, error) {
+	p.skipSpace()
+	if p.peek() != '{' {
+		return nil, p.errorf(KindUnexpected, p.pos, p.pos+1, "expected { after \\%s", name)
+	}
+	p.pos++
+
+	textStart := p.pos
+	var content []rune
+	for depth := 1; ; {
+		if p.done() {
+			return nil, p.errorf(KindUnmatched, start, textStart, "unmatched start brace")
+		}
+		c := p.in[p.pos]
+		switch c {
+		case '{':
+			depth++
+		case '}':
+			depth--
+		case '\\':
+			if r, ok := p.readTextEscape(); ok {
+				content = append(content, r)
+				continue
+			}
+		}
+		p.pos++
+		if depth == 0 {
+			break
+		}
+		content = append(content, c)
+	}
+	if len(content) == 0 {
+		return nil, nil
+	}
+	return &Term{Content: content, Style: style}, nil
+}
+
+// readTextEscape consumes an escaped character in text mode, such as \%
+// or \textbackslash{}, as written by escapeLaTeXText, returning the
+// character. If there is none at the current position, ok is false.
+func (p *latexParser) readTextEscape() (r rune, ok bool) {
+	switch name := p.peekCommand(); name {
+	case "{", "}", "%", "$", "&", "#", "_", "^", "~":
+		r = []rune(name)[0]
+	case "textbackslash":
+		r = '\\'
+	default:
+		return 0, false
+	}
+	p.readCommand()
+	if r == '\\' || r == '^' || r == '~' {
+		// Skip the empty group ending the command, as in \^{}.
+		if p.pos+1 < len(p.in) && p.in[p.pos] == '{' && p.in[p.pos+1] == '}' {
+			p.pos += 2
+		}
+	}
+	return r, true
+}
+
+func isLaTeXLetter(c rune) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func isLaTeXOperator(c rune) bool {
+	switch c {
+	case '+', '-', '*', '/', '=', '<', '>', ',', ';', ':', '|', '(', ')', '[', ']':
+		return true
+	}
+	return false
+}
+
+// isLaTeXOrdinary returns true if c can form part of a multi-character term.
+func isLaTeXOrdinary(c rune) bool {
+	switch c {
+	case '{', '}', '\\', '^', '_', '~', '&', '$', '#', '%':
+		return false
+	}
+	return !unicode.IsSpace(c) && !isLaTeXOperator(c)
+}
+
+// seqNode returns the node representing a sequence of terms.
+func seqNode(terms []Node) Node {
+	switch len(terms) {
+	case 0:
+		return nil
+	case 1:
+		return terms[0]
+	default:
+		return &Run{Terms: terms}
+	}
+}
+
+// ParseLaTeX attempts to generate the node tree by parsing a LaTeX math-mode
+// representation of the equation, such as \frac{1}{\sqrt{x}}. Only a subset
+// of LaTeX is supported: unknown commands return a *ParseError.
+func ParseLaTeX(inp string) (Node, error) {
+	p := latexParser{in: []rune(inp)}
+	n, err := p.parse()
+	return n, locateError(err, inp)
+}
+
+// parse parses the whole equation.
+func (p *latexParser) parse() (Node, error) {
+	terms, err := p.parseSeq()
+	if err != nil {
+		return nil, err
+	}
+
+	if !p.done() {
+		switch p.peek() {
+		case '}':
+			return nil, p.errorf(KindUnmatched, p.pos, p.pos+1, "unmatched end brace")
+		default:
+			return nil, p.errorf(KindUnmatched, p.pos, p.pos+len(`\right`), "unmatched \\right")
+		}
+	}
+	return seqNode(terms), nil
+}
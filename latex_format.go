@@ -0,0 +1,374 @@
+package eqdraw
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// latexCommands maps runes to the command for the symbol or operator which
+// draws them. Where several commands draw the same rune, the shortest is
+// used.
+var latexCommands = func() map[rune]string {
+	out := map[rune]string{}
+	add := func(name string, r rune) {
+		if prev, ok := out[r]; ok && (len(prev) < len(name) || (len(prev) == len(name) && prev < name)) {
+			return
+		}
+		out[r] = name
+	}
+	for name, r := range latexSymbols {
+		add(name, r)
+	}
+	for name, r := range latexOperators {
+		add(name, r)
+	}
+	return out
+}()
+
+// latexStyles maps font styles to the command setting a term in them.
+var latexStyles = map[FontStyle]string{
+	StyleRegular:    "mathrm",
+	StyleItalic:     "mathit",
+	StyleBold:       "mathbf",
+	StyleBoldItalic: "boldsymbol",
+}
+
+// latexFormatter accumulates the LaTeX for a node tree.
+type latexFormatter struct {
+	b strings.Builder
+	// command is true if the last thing written was a command named with
+	// letters, which must be separated from a following letter.
+	command bool
+}
+
+// FormatLaTeX returns the LaTeX math-mode representation of a node tree,
+// such as \frac{1}{\sqrt{x}}. Characters which are special to LaTeX are
+// escaped, and terms are set in the style they are drawn in. An error is
+// returned if the tree contains a node with no LaTeX equivalent, such as a
+// custom node.
+func FormatLaTeX(n Node) (string, error) {
+	var f latexFormatter
+	if err := f.node(n); err != nil {
+		return "", err
+	}
+	return f.b.String(), nil
+}
+
+// write writes s, which must not start with a letter after a command.
+func (f *latexFormatter) write(s string) {
+	f.b.WriteString(s)
+	f.command = false
+}
+
+// writeCommand writes the command named name.
+func (f *latexFormatter) writeCommand(name string) {
+	f.b.WriteString(`\` + name)
+	f.command = isLaTeXLetter(rune(name[len(name)-1]))
+}
+
+// writeRune writes c, separating it from any preceding command.
+func (f *latexFormatter) writeRune(c rune) {
+	if f.command && isLaTeXLetter(c) {
+		f.b.WriteByte(' ')
+	}
+	f.b.WriteRune(c)
+	f.command = false
+}
+
+// group writes n within braces.
+func (f *latexFormatter) group(n Node) error {
+	f.write("{")
+	if err := f.node(n); err != nil {
+		return err
+	}
+	f.write("}")
+	return nil
+}
+
+func (f *latexFormatter) node(n Node) error {
+	switch n := n.(type) {
+	case nil:
+	case *Term:
+		f.term(n)
+
+	case *Run:
+		for i, t := range n.Terms {
+			if i > 0 {
+				f.write(" ")
+			}
+			// The body of a large operator runs to the next relation
+			// in its sequence, so it must be braced if anything
+			// follows it. A run containing a relation is braced so
+			// that it does not end the body of a large operator.
+			_, bigOp := t.(*BigOp)
+			_, run := t.(*Run)
+			var err error
+			if (bigOp && i < len(n.Terms)-1) || (run && hasRelation(t)) {
+				err = f.group(t)
+			} else {
+				err = f.node(t)
+			}
+			if err != nil {
+				return err
+			}
+		}
+
+	case *BigOp:
+		return f.bigOp(n)
+
+	case *Matrix:
+		return f.matrix(n)
+
+	case *Div:
+		f.writeCommand("frac")
+		if err := f.group(n.Numerator); err != nil {
+			return err
+		}
+		return f.group(n.Denominator)
+
+	case *Root:
+		f.writeCommand("sqrt")
+		if n.Index != nil {
+			// A bracket within the index must be braced, so it does not
+			// end the index.
+			var idx latexFormatter
+			if err := idx.node(n.Index); err != nil {
+				return err
+			}
+			s := idx.b.String()
+			if strings.Contains(s, "]") {
+				s = "{" + s + "}"
+			}
+			f.write("[" + s + "]")
+		}
+		return f.group(n.Term)
+
+	case *Parenthesis:
+		f.writeCommand("left")
+		f.write("(")
+		if err := f.node(n.Term); err != nil {
+			return err
+		}
+		f.writeCommand("right")
+		f.write(")")
+
+	case *Sup:
+		if err := f.base(n.Base); err != nil {
+			return err
+		}
+		f.write("^")
+		return f.group(n.Exponent)
+
+	case *Sub:
+		if err := f.base(n.Base); err != nil {
+			return err
+		}
+		f.write("_")
+		if err := f.group(n.Index); err != nil {
+			return err
+		}
+		if n.Exponent != nil {
+			f.write("^")
+			return f.group(n.Exponent)
+		}
+
+	default:
+		return fmt.Errorf("latex: unsupported node type %T", n)
+	}
+	return nil
+}
+
+// bigOp writes a large operator, such as \sum_{i=1}^{n} i.
+func (f *latexFormatter) bigOp(b *BigOp) error {
+	var name string
+	for n, op := range latexBigOps {
+		if op == b.Op {
+			name = n
+		}
+	}
+	if name == "" {
+		return fmt.Errorf("latex: unsupported operator %q", b.Op)
+	}
+	f.writeCommand(name)
+	if b.Lower != nil {
+		f.write("_")
+		if err := f.group(b.Lower); err != nil {
+			return err
+		}
+	}
+	if b.Upper != nil {
+		f.write("^")
+		if err := f.group(b.Upper); err != nil {
+			return err
+		}
+	}
+	switch {
+	case hasRelation(b.Body):
+		// The body would otherwise end at the relation when parsed.
+		f.write(" ")
+		return f.group(b.Body)
+	case b.Body != nil:
+		f.write(" ")
+		return f.node(b.Body)
+	}
+	return nil
+}
+
+// latexDelims maps delimiters to the \left and \right arguments drawing
+// them.
+var latexDelims = map[Delimiter][2]string{
+	DelimParens:     {"(", ")"},
+	DelimBrackets:   {"[", "]"},
+	DelimBraces:     {`\{`, `\}`},
+	DelimBars:       {"|", "|"},
+	DelimDoubleBars: {`\|`, `\|`},
+}
+
+// matrix writes a matrix as an environment, such as
+// \begin{pmatrix}a & b \\ c & d\end{pmatrix}. Matrices with aligned columns
+// are written as an array, within \left and \right delimiters. The spacing
+// of the cells is not written.
+func (f *latexFormatter) matrix(m *Matrix) error {
+	var spec strings.Builder
+	aligned := false
+	for i := 0; i < m.columns(); i++ {
+		for c, a := range latexAlignments {
+			if a == m.align(i) {
+				spec.WriteRune(c)
+			}
+		}
+		aligned = aligned || m.align(i) != AlignCenter
+	}
+
+	env := "array"
+	delims, wrap := latexDelims[m.Delims]
+	if !aligned {
+		for name, d := range latexMatrices {
+			if d == m.Delims && name != "array" {
+				env = name
+			}
+		}
+		wrap = false
+	}
+
+	if wrap {
+		f.writeCommand("left")
+		f.write(delims[0])
+	}
+	f.writeCommand("begin")
+	f.write("{" + env + "}")
+	if env == "array" {
+		f.write("{" + spec.String() + "}")
+	}
+	for i, row := range m.Rows {
+		if i > 0 {
+			f.write(` \\ `)
+		}
+		for j, c := range row {
+			if j > 0 {
+				f.write(" & ")
+			}
+			if err := f.node(c); err != nil {
+				return err
+			}
+		}
+	}
+	f.writeCommand("end")
+	f.write("{" + env + "}")
+	if wrap {
+		f.writeCommand("right")
+		f.write(delims[1])
+	}
+	return nil
+}
+
+// base writes the base of a script. Bases which LaTeX would not treat as a
+// single atom are braced.
+func (f *latexFormatter) base(n Node) error {
+	switch n := n.(type) {
+	case *Parenthesis, *Root:
+		return f.node(n)
+	case *Term:
+		if len(n.Content) == 1 || n.Style != StyleAuto {
+			return f.node(n)
+		}
+	}
+	return f.group(n)
+}
+
+func (f *latexFormatter) term(t *Term) {
+	s := string(t.Content)
+	if strings.IndexFunc(s, unicode.IsSpace) >= 0 {
+		// Terms containing spaces are text, such as from \text{...}.
+		switch t.Style {
+		case StyleBold:
+			f.writeCommand("textbf")
+		case StyleItalic:
+			f.writeCommand("textit")
+		default:
+			f.writeCommand("text")
+		}
+		f.write("{" + escapeLaTeXText(s) + "}")
+		return
+	}
+	if t.Style == StyleRegular && latexFunctions[s] {
+		f.writeCommand(s)
+		return
+	}
+
+	style, styled := latexStyles[t.Style]
+	if styled {
+		f.writeCommand(style)
+		f.write("{")
+	}
+	for _, c := range t.Content {
+		f.mathRune(c)
+	}
+	if styled {
+		f.write("}")
+	}
+}
+
+// mathRune writes c in math mode, escaping it or replacing it with a
+// command if needed.
+func (f *latexFormatter) mathRune(c rune) {
+	switch c {
+	case '{', '}', '%', '$', '&', '#', '_':
+		f.write(`\` + string(c))
+	case '\\':
+		f.writeCommand("backslash")
+	case '^':
+		f.writeCommand("text")
+		f.write(`{\^{}}`)
+	case '~':
+		f.writeCommand("sim")
+	default:
+		if name, ok := latexCommands[c]; ok {
+			f.writeCommand(name)
+			return
+		}
+		f.writeRune(c)
+	}
+}
+
+// escapeLaTeXText escapes the characters of s which are special to LaTeX in
+// text mode.
+func escapeLaTeXText(s string) string {
+	var b strings.Builder
+	for _, c := range s {
+		switch c {
+		case '{', '}', '%', '$', '&', '#', '_':
+			b.WriteString(`\` + string(c))
+		case '\\':
+			b.WriteString(`\textbackslash{}`)
+		case '^':
+			b.WriteString(`\^{}`)
+		case '~':
+			b.WriteString(`\~{}`)
+		default:
+			b.WriteRune(c)
+		}
+	}
+	return b.String()
+}
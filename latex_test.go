@@ -0,0 +1,543 @@
+package eqdraw
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestLaTeX(t *testing.T) {
+	tcs := []struct {
+		name     string
+		input    string
+		expected Node
+		err      *ParseError
+	}{
+		{
+			name:  "basic",
+			input: "1 + 2",
+			expected: &Run{Terms: []Node{
+				&Term{Content: []rune{'1'}},
+				&Term{Content: []rune{'+'}},
+				&Term{Content: []rune{'2'}},
+			}},
+		},
+		{
+			name:  "line",
+			input: "y=mx+b",
+			expected: &Run{Terms: []Node{
+				&Term{Content: []rune{'y'}},
+				&Term{Content: []rune{'='}},
+				&Term{Content: []rune{'m', 'x'}},
+				&Term{Content: []rune{'+'}},
+				&Term{Content: []rune{'b'}},
+			}},
+		},
+		{
+			name:  "frac",
+			input: `\frac{a}{b + 1}`,
+			expected: &Div{
+				Numerator:   &Term{Content: []rune{'a'}},
+				Denominator: &Run{Terms: []Node{&Term{Content: []rune{'b'}}, &Term{Content: []rune{'+'}}, &Term{Content: []rune{'1'}}}},
+			},
+		},
+		{
+			name:  "frac unbraced",
+			input: `\frac12`,
+			expected: &Div{
+				Numerator:   &Term{Content: []rune{'1'}},
+				Denominator: &Term{Content: []rune{'2'}},
+			},
+		},
+		{
+			name:  "sqrt",
+			input: `\sqrt{12 - a}`,
+			expected: &Root{Term: &Run{Terms: []Node{
+				&Term{Content: []rune{'1', '2'}},
+				&Term{Content: []rune{'-'}},
+				&Term{Content: []rune{'a'}},
+			}}},
+		},
+		{
+			name:  "nth root",
+			input: `\sqrt[n+1]{x} - \sqrt [3] 8`,
+			expected: &Run{Terms: []Node{
+				&Root{
+					Index: &Run{Terms: []Node{
+						&Term{Content: []rune{'n'}},
+						&Term{Content: []rune{'+'}},
+						&Term{Content: []rune{'1'}},
+					}},
+					Term: &Term{Content: []rune{'x'}},
+				},
+				&Term{Content: []rune{'-'}},
+				&Root{Index: &Term{Content: []rune{'3'}}, Term: &Term{Content: []rune{'8'}}},
+			}},
+		},
+		{
+			name:  "left right",
+			input: `2\left( b+1 \right)`,
+			expected: &Run{Terms: []Node{
+				&Term{Content: []rune{'2'}},
+				&Parenthesis{Term: &Run{
+					Terms: []Node{
+						&Term{Content: []rune{'b'}},
+						&Term{Content: []rune{'+'}},
+						&Term{Content: []rune{'1'}},
+					},
+				}},
+			}},
+		},
+		{
+			name:  "bare parenthesis",
+			input: `(1)`,
+			expected: &Parenthesis{
+				Term: &Term{Content: []rune{'1'}},
+			},
+		},
+		{
+			name:  "scripts",
+			input: `e^{i\pi} + x_i^2 + a_{n+1}`,
+			expected: &Run{Terms: []Node{
+				&Sup{
+					Base:     &Term{Content: []rune{'e'}},
+					Exponent: &Run{Terms: []Node{&Term{Content: []rune{'i'}}, &Term{Content: []rune{'π'}}}},
+				},
+				&Term{Content: []rune{'+'}},
+				&Sub{
+					Base:     &Term{Content: []rune{'x'}},
+					Index:    &Term{Content: []rune{'i'}},
+					Exponent: &Term{Content: []rune{'2'}},
+				},
+				&Term{Content: []rune{'+'}},
+				&Sub{
+					Base:  &Term{Content: []rune{'a'}},
+					Index: &Run{Terms: []Node{&Term{Content: []rune{'n'}}, &Term{Content: []rune{'+'}}, &Term{Content: []rune{'1'}}}},
+				},
+			}},
+		},
+		{
+			name:  "symbols and text",
+			input: `x \leq \text{max} \cdot \alpha`,
+			expected: &Run{Terms: []Node{
+				&Term{Content: []rune{'x'}},
+				&Term{Content: []rune{'≤'}},
+				&Term{Content: []rune("max"), Style: StyleRegular},
+				&Term{Content: []rune{'·'}},
+				&Term{Content: []rune{'α'}},
+			}},
+		},
+		{
+			name:     "escaped text",
+			input:    `\text{a\_b \{c\} 5\% \textbackslash{}n}`,
+			expected: &Term{Content: []rune(`a_b {c} 5% \n`), Style: StyleRegular},
+		},
+		{
+			name:  "unknown command",
+			input: `1 + \foo{2}`,
+			err:   &ParseError{Pos: 5, Offset: 4, Line: 1, Column: 5, Len: 4, Kind: KindUnsupported, Msg: `unknown command \foo`},
+		},
+		{
+			name:  "unmatched brace",
+			input: `\frac{1}{2`,
+			err:   &ParseError{Pos: 9, Offset: 8, Line: 1, Column: 9, Len: 1, Kind: KindUnmatched, Msg: "unmatched start brace"},
+		},
+		{
+			name:  "unmatched bracket",
+			input: `\sqrt[3{x}`,
+			err:   &ParseError{Pos: 6, Offset: 5, Line: 1, Column: 6, Len: 1, Kind: KindUnmatched, Msg: "unmatched start bracket"},
+		},
+		{
+			name:  "unmatched left",
+			input: `a \left( b`,
+			err:   &ParseError{Pos: 3, Offset: 2, Line: 1, Column: 3, Len: 5, Kind: KindUnmatched, Msg: `unmatched \left`},
+		},
+		{
+			name:  "unmatched right",
+			input: `a \right) b`,
+			err:   &ParseError{Pos: 3, Offset: 2, Line: 1, Column: 3, Len: 6, Kind: KindUnmatched, Msg: `unmatched \right`},
+		},
+		{
+			name:  "half-open intervals",
+			input: `[0, 1) \cup (a, b]`,
+			expected: &Run{Terms: []Node{
+				&Term{Content: []rune{'['}},
+				&Term{Content: []rune{'0'}},
+				&Term{Content: []rune{','}},
+				&Term{Content: []rune{'1'}},
+				&Term{Content: []rune{')'}},
+				&Term{Content: []rune{'∪'}},
+				&Term{Content: []rune{'('}},
+				&Term{Content: []rune{'a'}},
+				&Term{Content: []rune{','}},
+				&Term{Content: []rune{'b'}},
+				&Term{Content: []rune{']'}},
+			}},
+		},
+		{
+			name:  "nested parentheses",
+			input: `f(x(y)^2`,
+			expected: &Run{Terms: []Node{
+				&Term{Content: []rune{'f'}},
+				&Term{Content: []rune{'('}},
+				&Term{Content: []rune{'x'}},
+				&Sup{
+					Base:     &Parenthesis{Term: &Term{Content: []rune{'y'}}},
+					Exponent: &Term{Content: []rune{'2'}},
+				},
+			}},
+		},
+		{
+			name:  "sum in parentheses",
+			input: `(\sum_i i) + 1`,
+			expected: &Run{Terms: []Node{
+				&Parenthesis{Term: &BigOp{
+					Op:    OpSum,
+					Lower: &Term{Content: []rune{'i'}},
+					Body:  &Term{Content: []rune{'i'}},
+				}},
+				&Term{Content: []rune{'+'}},
+				&Term{Content: []rune{'1'}},
+			}},
+		},
+		{
+			name:  "left and right delimiters",
+			input: `\left[ x \right) + \left\| v \right\|`,
+			expected: &Run{Terms: []Node{
+				&Term{Content: []rune{'['}},
+				&Term{Content: []rune{'x'}},
+				&Term{Content: []rune{')'}},
+				&Term{Content: []rune{'+'}},
+				&Term{Content: []rune{'‖'}},
+				&Term{Content: []rune{'v'}},
+				&Term{Content: []rune{'‖'}},
+			}},
+		},
+		{
+			name:  "empty delimiters",
+			input: `\left\{ x \right. + \left. y \right| + \left.z\right.`,
+			expected: &Run{Terms: []Node{
+				&Term{Content: []rune{'{'}},
+				&Term{Content: []rune{'x'}},
+				&Term{Content: []rune{'+'}},
+				&Term{Content: []rune{'y'}},
+				&Term{Content: []rune{'|'}},
+				&Term{Content: []rune{'+'}},
+				&Term{Content: []rune{'z'}},
+			}},
+		},
+		{
+			name:  "unsupported delimiter",
+			input: `\left< x \right>`,
+			err:   &ParseError{Pos: 1, Offset: 0, Line: 1, Column: 1, Len: 6, Kind: KindUnsupported, Msg: `unsupported delimiter after \left`},
+		},
+		{
+			name:  "double superscript",
+			input: `x^2^3`,
+			err:   &ParseError{Pos: 4, Offset: 3, Line: 1, Column: 4, Len: 1, Kind: KindUnexpected, Msg: "double superscript"},
+		},
+		{
+			name:  "sum",
+			input: `y = \sum\limits_{i=1}^n i^2`,
+			expected: &Run{Terms: []Node{
+				&Term{Content: []rune{'y'}},
+				&Term{Content: []rune{'='}},
+				&BigOp{
+					Op: OpSum,
+					Lower: &Run{Terms: []Node{
+						&Term{Content: []rune{'i'}},
+						&Term{Content: []rune{'='}},
+						&Term{Content: []rune{'1'}},
+					}},
+					Upper: &Term{Content: []rune{'n'}},
+					Body:  &Sup{Base: &Term{Content: []rune{'i'}}, Exponent: &Term{Content: []rune{'2'}}},
+				},
+			}},
+		},
+		{
+			name:  "sum before relation",
+			input: `\sum_i i = x \le \prod_j (j = 1) \ne y`,
+			expected: &Run{Terms: []Node{
+				&BigOp{Op: OpSum, Lower: &Term{Content: []rune{'i'}}, Body: &Term{Content: []rune{'i'}}},
+				&Term{Content: []rune{'='}},
+				&Term{Content: []rune{'x'}},
+				&Term{Content: []rune{'≤'}},
+				&BigOp{
+					Op:    OpProduct,
+					Lower: &Term{Content: []rune{'j'}},
+					Body: &Parenthesis{Term: &Run{Terms: []Node{
+						&Term{Content: []rune{'j'}},
+						&Term{Content: []rune{'='}},
+						&Term{Content: []rune{'1'}},
+					}}},
+				},
+				&Term{Content: []rune{'≠'}},
+				&Term{Content: []rune{'y'}},
+			}},
+		},
+		{
+			name:  "integral in parenthesis",
+			input: `\left(\int_0^1 x dx\right) + \bigcup A`,
+			expected: &Run{Terms: []Node{
+				&Parenthesis{Term: &BigOp{
+					Op:    OpIntegral,
+					Lower: &Term{Content: []rune{'0'}},
+					Upper: &Term{Content: []rune{'1'}},
+					Body: &Run{Terms: []Node{
+						&Term{Content: []rune{'x'}},
+						&Term{Content: []rune("dx")},
+					}},
+				}},
+				&Term{Content: []rune{'+'}},
+				&BigOp{Op: '⋃', Body: &Term{Content: []rune{'A'}}},
+			}},
+		},
+		{
+			name:  "pmatrix",
+			input: `\begin{pmatrix} 1 & \alpha \\ x^2 & \end{pmatrix} v`,
+			expected: &Run{Terms: []Node{
+				&Matrix{
+					Rows: [][]Node{
+						{&Term{Content: []rune{'1'}}, &Term{Content: []rune{'α'}}},
+						{&Sup{Base: &Term{Content: []rune{'x'}}, Exponent: &Term{Content: []rune{'2'}}}, nil},
+					},
+					Delims: DelimParens,
+				},
+				&Term{Content: []rune{'v'}},
+			}},
+		},
+		{
+			name:  "array",
+			input: `\begin{array}{r l} a & b \\ \end{array}`,
+			expected: &Matrix{
+				Rows:  [][]Node{{&Term{Content: []rune{'a'}}, &Term{Content: []rune{'b'}}}},
+				Align: []Alignment{AlignRight, AlignLeft},
+			},
+		},
+		{
+			name:  "unsupported environment",
+			input: `\begin{align} a \end{align}`,
+			err:   &ParseError{Pos: 1, Offset: 0, Line: 1, Column: 1, Len: 13, Kind: KindUnsupported, Msg: "unsupported environment align"},
+		},
+		{
+			name:  "mismatched environment",
+			input: `\begin{matrix} a \end{bmatrix}`,
+			err:   &ParseError{Pos: 18, Offset: 17, Line: 1, Column: 18, Len: 13, Kind: KindUnexpected, Msg: `\end{bmatrix} does not match \begin{matrix}`},
+		},
+		{
+			name:  "unmatched environment",
+			input: `x + \begin{vmatrix} a & b`,
+			err:   &ParseError{Pos: 5, Offset: 4, Line: 1, Column: 5, Len: 6, Kind: KindUnmatched, Msg: `unmatched \begin{vmatrix}`},
+		},
+		{
+			name:  "cell outside environment",
+			input: `a & b`,
+			err:   &ParseError{Pos: 3, Offset: 2, Line: 1, Column: 3, Len: 1, Kind: KindUnsupported, Msg: `unsupported character '&'`},
+		},
+		{
+			name:     "big operator in script",
+			input:    `x^\prod`,
+			expected: &Sup{Base: &Term{Content: []rune{'x'}}, Exponent: &Term{Content: []rune{'∏'}}},
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			out, err := ParseLaTeX(tc.input)
+			if tc.err != nil {
+				if diff := cmp.Diff(err, error(tc.err)); diff != "" {
+					t.Errorf("err differed:\n%s", diff)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseLaTeX() failed: %v", err)
+			}
+			if diff := cmp.Diff(out, tc.expected); diff != "" {
+				t.Errorf("output differed:\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestFormatLaTeX(t *testing.T) {
+	tcs := []struct {
+		name     string
+		node     Node
+		expected string
+		err      bool
+	}{
+		{
+			name:     "nil",
+			expected: "",
+		},
+		{
+			name: "frac and sqrt",
+			node: &Div{
+				Numerator:   &Term{Content: []rune("1")},
+				Denominator: &Root{Term: &Term{Content: []rune("x")}},
+			},
+			expected: `\frac{1}{\sqrt{x}}`,
+		},
+		{
+			name: "nth root",
+			node: &Root{
+				Index: &Term{Content: []rune("n")},
+				Term:  &Term{Content: []rune("x")},
+			},
+			expected: `\sqrt[n]{x}`,
+		},
+		{
+			name: "parenthesis",
+			node: &Run{Terms: []Node{
+				&Term{Content: []rune("2")},
+				&Parenthesis{Term: &Run{Terms: []Node{
+					&Term{Content: []rune("b")},
+					&Term{Content: []rune("+")},
+					&Term{Content: []rune("1")},
+				}}},
+			}},
+			expected: `2 \left(b + 1\right)`,
+		},
+		{
+			name:     "symbols",
+			node:     &Term{Content: []rune("2πr≤x")},
+			expected: `2\pi r\le x`,
+		},
+		{
+			name:     "special characters",
+			node:     &Term{Content: []rune(`a_b{c}%$&#\~^`)},
+			expected: `a\_b\{c\}\%\$\&\#\backslash\sim\text{\^{}}`,
+		},
+		{
+			name:     "function",
+			node:     &Term{Content: []rune("sin"), Style: StyleRegular},
+			expected: `\sin`,
+		},
+		{
+			name:     "styled",
+			node:     &Term{Content: []rune("v"), Style: StyleBold},
+			expected: `\mathbf{v}`,
+		},
+		{
+			name:     "text",
+			node:     &Term{Content: []rune("if x_1 > 0"), Style: StyleRegular},
+			expected: `\text{if x\_1 > 0}`,
+		},
+		{
+			name: "scripts",
+			node: &Run{Terms: []Node{
+				&Sup{Base: &Term{Content: []rune("xy")}, Exponent: &Term{Content: []rune("2")}},
+				&Sub{
+					Base:     &Parenthesis{Term: &Term{Content: []rune("a")}},
+					Index:    &Term{Content: []rune("i")},
+					Exponent: &Div{Numerator: &Term{Content: []rune("1")}, Denominator: &Term{Content: []rune("2")}},
+				},
+			}},
+			expected: `{xy}^{2} \left(a\right)_{i}^{\frac{1}{2}}`,
+		},
+		{
+			name: "big operator",
+			node: &Run{Terms: []Node{
+				&BigOp{
+					Op:    OpSum,
+					Lower: &Term{Content: []rune("k")},
+					Body:  &Div{Numerator: &Term{Content: []rune("1")}, Denominator: &Term{Content: []rune("k")}},
+				},
+				&Term{Content: []rune("+")},
+				&BigOp{Op: OpIntegral, Upper: &Term{Content: []rune("1")}, Body: &Term{Content: []rune("x")}},
+			}},
+			expected: `{\sum_{k} \frac{1}{k}} + \int^{1} x`,
+		},
+		{
+			name: "matrix",
+			node: &Matrix{
+				Rows:   [][]Node{{&Term{Content: []rune("a")}, nil}, {&Term{Content: []rune("c")}, &Term{Content: []rune("β")}}},
+				Delims: DelimBrackets,
+			},
+			expected: `\begin{bmatrix}a &  \\ c & \beta\end{bmatrix}`,
+		},
+		{
+			name: "aligned matrix",
+			node: &Matrix{
+				Rows:   [][]Node{{&Term{Content: []rune("a")}, &Term{Content: []rune("b")}, &Term{Content: []rune("c")}}},
+				Align:  []Alignment{AlignLeft, AlignRight},
+				Delims: DelimBraces,
+			},
+			expected: `\left\{\begin{array}{lrc}a & b & c\end{array}\right\}`,
+		},
+		{
+			name: "unknown big operator",
+			node: &BigOp{Op: '∰', Body: &Term{Content: []rune("x")}},
+			err:  true,
+		},
+		{
+			name: "custom node",
+			node: &Run{Terms: []Node{&Term{Content: []rune("a")}, &boxNode{}}},
+			err:  true,
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			out, err := FormatLaTeX(tc.node)
+			if tc.err {
+				if err == nil {
+					t.Errorf("FormatLaTeX() = %q, want error", out)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("FormatLaTeX() failed: %v", err)
+			}
+			if out != tc.expected {
+				t.Errorf("FormatLaTeX() = %q, want %q", out, tc.expected)
+			}
+		})
+	}
+}
+
+func TestFormatLaTeXRoundTrip(t *testing.T) {
+	for _, input := range []string{
+		`y = mx + b`,
+		`\frac{a}{b + 1}`,
+		`\sqrt{12 - a}`,
+		`\sqrt[3]{x} + \sqrt[{[n]}]{\frac{1}{2}}`,
+		`2\left( b+1 \right)`,
+		`e^{i\pi} + x_i^2 + a_{n+1}`,
+		`x \leq \text{max} \cdot \alpha`,
+		`\sin^2 \theta + \cos^{2}\theta = 1`,
+		`\mathbf{v} \times \boldsymbol{w}`,
+		`{ab}^2`,
+		`\{x \}`,
+		`\sum_{i=1}^{n} i = \frac{n(n+1)}{2}`,
+		`\sum_i {i = x} + \prod_j {=}`,
+		`\left(\oint\nolimits_C f\right)^2 - \iint`,
+		`\begin{Vmatrix} \frac{1}{2} & x \\ & \sum_i i \end{Vmatrix}^2`,
+		`\begin{array}{cr} a \\ b & c \end{array}`,
+		`\left\{\begin{array}{lr} a & b \end{array}\right\}`,
+		`\left(\begin{array}{rl} 1 & x \\ 2 & y \end{array}\right)^2`,
+		`[0, 1) + (a, b] + f(x)`,
+		`\left[x\right)^2`,
+		`\text{50\% of a\_b \{c\} \textbackslash{}n \^{}\~{} \$\&\#}`,
+		`f(x) = \left\{\begin{array}{ll} 1 & x > 0 \\ 0 & x \le 0 \end{array}\right.`,
+	} {
+		t.Run(input, func(t *testing.T) {
+			n, err := ParseLaTeX(input)
+			if err != nil {
+				t.Fatalf("ParseLaTeX(%q) failed: %v", input, err)
+			}
+			out, err := FormatLaTeX(n)
+			if err != nil {
+				t.Fatalf("FormatLaTeX() failed: %v", err)
+			}
+			reparsed, err := ParseLaTeX(out)
+			if err != nil {
+				t.Fatalf("ParseLaTeX(%q) failed: %v", out, err)
+			}
+			if diff := cmp.Diff(reparsed, n); diff != "" {
+				t.Errorf("round trip through %q differed:\n%s", out, diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,416 @@
+// Package markdown replaces the math in Markdown documents with rendered
+// images of it.
+//
+// Inline math is written between single dollar signs, such as $x^2$, and
+// display math between double dollar signs, such as $$a/b$$. Inline math is
+// drawn in inline style, with the limits of sums beside them, and display
+// math in display style. Each math span is parsed with
+// eqdraw.ParseASCIIEquation, rendered into an assets
+// directory, and replaced with an image link whose alt text is the source of
+// the equation. Code spans, fenced code blocks and indented code blocks are
+// left untouched, as are dollar signs escaped with a backslash.
+//
+// To avoid mistaking prices for math, an inline span must not begin or end
+// with a space, and its closing dollar sign must not be followed by a digit.
+package markdown
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/golang/freetype/truetype"
+	"github.com/twitchyliquid64/eqdraw"
+)
+
+// Options configures the rendering of math.
+type Options struct {
+	// Renderer draws the equations. If nil, equations are drawn with the
+	// default fonts at size 24. Its style is set for each span, so whether
+	// it draws in inline style is ignored.
+	Renderer *eqdraw.Renderer
+	// AssetsDir is the directory images are written to. It is created if
+	// it does not exist.
+	AssetsDir string
+	// LinkPrefix is prepended to the file name of each image to form its
+	// link, such as "assets" or "https://cdn.example.com/eq". If empty,
+	// AssetsDir is used, with slashes as separators. Characters which may
+	// not appear in a link, such as spaces, are percent-encoded.
+	LinkPrefix string
+	// Format is the format of the images: "png" (the default) or "svg".
+	Format string
+	// Foreground is the color equations are drawn in. If nil, they are
+	// drawn in black.
+	Foreground color.Color
+	// Background is drawn behind each equation. If nil, the images have a
+	// transparent background.
+	Background color.Color
+}
+
+// Error describes an equation which could not be rendered.
+type Error struct {
+	// Line is the line the equation starts on, starting from 1.
+	Line int
+	// Source is the text of the equation.
+	Source string
+	Err    error
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("line %d: equation %q: %v", e.Line, e.Source, e.Err)
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// processor holds the state of a call to Process.
+type processor struct {
+	opts Options
+	// rendered holds the link to each image written, keyed by file name.
+	rendered map[string]string
+}
+
+// Process returns a copy of the Markdown document src, with each math span
+// replaced with a link to a rendered image of it. If an equation cannot be
+// rendered, an *Error is returned.
+func Process(src []byte, opts Options) ([]byte, error) {
+	if opts.Renderer == nil {
+		r, err := eqdraw.NewRenderer(truetype.Options{Size: 24}, nil)
+		if err != nil {
+			return nil, err
+		}
+		opts.Renderer = r
+	}
+	switch opts.Format {
+	case "":
+		opts.Format = "png"
+	case "png", "svg":
+	default:
+		return nil, fmt.Errorf("unknown image format %q", opts.Format)
+	}
+	if opts.LinkPrefix == "" {
+		opts.LinkPrefix = filepath.ToSlash(opts.AssetsDir)
+	}
+	p := processor{opts: opts, rendered: map[string]string{}}
+
+	var (
+		out  bytes.Buffer
+		text []byte // Text awaiting the replacement of math.
+		// textLine is the line text starts on.
+		textLine = 1
+		// fence is the marker which opened the current fenced code block,
+		// or empty if not in one.
+		fence     string
+		indented  bool // In an indented code block.
+		prevBlank = true
+	)
+	flush := func() error {
+		if err := p.replaceMath(&out, text, textLine); err != nil {
+			return err
+		}
+		text = text[:0]
+		return nil
+	}
+
+	for i, line := range splitLines(src) {
+		blank := len(bytes.TrimSpace(line)) == 0
+		code := true
+		switch {
+		case fence != "":
+			if closesFence(line, fence) {
+				fence = ""
+			}
+		case fenceMarker(line) != "":
+			fence = fenceMarker(line)
+		case isIndentedCode(line) && (prevBlank || indented):
+			indented = true
+		case blank && indented:
+		default:
+			indented, code = false, false
+		}
+		prevBlank = blank
+
+		if !code {
+			if len(text) == 0 {
+				textLine = i + 1
+			}
+			text = append(text, line...)
+			continue
+		}
+		if err := flush(); err != nil {
+			return nil, err
+		}
+		out.Write(line)
+	}
+	if err := flush(); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+// splitLines splits src into lines, each including its line ending.
+func splitLines(src []byte) [][]byte {
+	var out [][]byte
+	for len(src) > 0 {
+		i := bytes.IndexByte(src, '\n') + 1
+		if i == 0 {
+			i = len(src)
+		}
+		out = append(out, src[:i])
+		src = src[i:]
+	}
+	return out
+}
+
+// fenceMarker returns the run of backticks or tildes opening a fenced code
+// block on line, or the empty string if line does not open one.
+func fenceMarker(line []byte) string {
+	s := strings.TrimLeft(string(line), " ")
+	if len(line)-len(s) > 3 || len(s) < 3 || (s[0] != '`' && s[0] != '~') {
+		return ""
+	}
+	n := len(s) - len(strings.TrimLeft(s, s[:1]))
+	if n < 3 || (s[0] == '`' && strings.Contains(s[n:], "`")) {
+		return ""
+	}
+	return s[:n]
+}
+
+// closesFence returns true if line closes the fenced code block opened by
+// fence.
+func closesFence(line []byte, fence string) bool {
+	s := strings.TrimSpace(string(line))
+	return strings.HasPrefix(s, fence) && strings.Trim(s, fence[:1]) == ""
+}
+
+// isIndentedCode returns true if line is indented enough to be part of an
+// indented code block.
+func isIndentedCode(line []byte) bool {
+	return len(bytes.TrimSpace(line)) > 0 && (bytes.HasPrefix(line, []byte("    ")) || bytes.HasPrefix(line, []byte("\t")))
+}
+
+// replaceMath writes text to out, replacing each math span with an image
+// link. The text starts on the given line of the document.
+func (p *processor) replaceMath(out *bytes.Buffer, text []byte, line int) error {
+	for i := 0; i < len(text); {
+		c := text[i]
+		switch {
+		case c == '\\' && i+1 < len(text):
+			out.Write(text[i : i+2])
+			i += 2
+			continue
+
+		case c == '`':
+			// Copy code spans verbatim, up to the matching run of backticks.
+			n := runLength(text[i:], '`')
+			if end := findRun(text[i+n:], '`', n); end >= 0 {
+				n += end + n
+			}
+			out.Write(text[i : i+n])
+			i += n
+			continue
+
+		case c == '$':
+			if src, n := mathSpan(text[i:]); n > 0 {
+				startLine := line + bytes.Count(text[:i], []byte("\n"))
+				display := bytes.HasPrefix(text[i:], []byte("$$"))
+				link, err := p.render(src, startLine, display)
+				if err != nil {
+					return err
+				}
+				out.WriteString(link)
+				i += n
+				continue
+			}
+		}
+		out.WriteByte(c)
+		i++
+	}
+	return nil
+}
+
+// runLength returns the number of times c is repeated at the start of b.
+func runLength(b []byte, c byte) int {
+	n := 0
+	for n < len(b) && b[n] == c {
+		n++
+	}
+	return n
+}
+
+// findRun returns the index of the first run of exactly n of the byte c in
+// b, or -1 if there is none.
+func findRun(b []byte, c byte, n int) int {
+	for i := 0; i < len(b); {
+		if b[i] != c {
+			i++
+			continue
+		}
+		l := runLength(b[i:], c)
+		if l == n {
+			return i
+		}
+		i += l
+	}
+	return -1
+}
+
+// mathSpan returns the source of the math span at the start of b, and the
+// length of the span including its delimiters. The length is zero if b does
+// not start with a math span. Spans do not continue past a blank line.
+func mathSpan(b []byte) (src string, n int) {
+	if bytes.HasPrefix(b, []byte("$$")) {
+		end := bytes.Index(b[2:], []byte("$$"))
+		if end < 0 || bytes.Contains(b[2:2+end], []byte("\n\n")) {
+			return "", 0
+		}
+		src = strings.TrimSpace(string(b[2 : 2+end]))
+		if src == "" {
+			return "", 0
+		}
+		return src, end + 4
+	}
+
+	if len(b) < 3 || b[1] == ' ' || b[1] == '\n' {
+		return "", 0
+	}
+	for i := 2; i < len(b); i++ {
+		switch {
+		case b[i] == '\\':
+			i++
+		case b[i] == '\n' && i+1 < len(b) && b[i+1] == '\n':
+			return "", 0
+		case b[i] == '$':
+			if b[i-1] == ' ' || b[i-1] == '\n' || (i+1 < len(b) && b[i+1] >= '0' && b[i+1] <= '9') {
+				return "", 0
+			}
+			return string(b[1:i]), i + 1
+		}
+	}
+	return "", 0
+}
+
+// render renders the equation src, in display style if display is true,
+// returning the Markdown for a link to the image.
+func (p *processor) render(src string, line int, display bool) (string, error) {
+	// Equations are rendered on a single line.
+	eqSrc := strings.Join(strings.Fields(src), " ")
+	n, err := eqdraw.ParseASCIIEquation(eqSrc)
+	if err != nil {
+		return "", &Error{Line: line, Source: eqSrc, Err: err}
+	}
+	if n == nil {
+		return "", &Error{Line: line, Source: eqSrc, Err: fmt.Errorf("empty equation")}
+	}
+
+	r := p.opts.Renderer.WithInline(!display)
+	name := p.fileName(eqSrc, r)
+	link, ok := p.rendered[name]
+	if !ok {
+		data, err := p.draw(n, r)
+		if err != nil {
+			return "", &Error{Line: line, Source: eqSrc, Err: err}
+		}
+		if err := os.MkdirAll(p.opts.AssetsDir, 0755); err != nil {
+			return "", err
+		}
+		if err := ioutil.WriteFile(filepath.Join(p.opts.AssetsDir, name), data, 0644); err != nil {
+			return "", err
+		}
+		link = name
+		if p.opts.LinkPrefix != "" {
+			link = strings.TrimSuffix(p.opts.LinkPrefix, "/") + "/" + name
+		}
+		link = escapeLink(link)
+		p.rendered[name] = link
+	}
+	return "![" + escapeAlt(eqSrc) + "](" + link + ")", nil
+}
+
+// fileName returns the name of the image for the equation src, drawn by r.
+// Names are derived from the equation and everything which changes how it
+// is drawn, so unchanged equations keep their names when a document is
+// processed again.
+func (p *processor) fileName(src string, r *eqdraw.Renderer) string {
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\x00%v\x00%d\x00%t\x00%s\x00%v\x00%v\x00%s", src, r.Options(), r.Padding(), r.Inline(), fontsKey(r.Fonts()), p.opts.Foreground, p.opts.Background, p.opts.Format)
+	return "eq-" + hex.EncodeToString(h.Sum(nil))[:16] + "." + p.opts.Format
+}
+
+// fontsKey returns a string identifying the fonts of a font set, which is
+// the same each time the fonts are loaded.
+func fontsKey(fs eqdraw.FontSet) string {
+	fonts := append([]*truetype.Font{fs.Regular, fs.Italic, fs.Bold, fs.BoldItalic, fs.Symbol}, fs.Fallback...)
+	names := make([]string, len(fonts))
+	for i, f := range fonts {
+		if f != nil {
+			names[i] = f.Name(truetype.NameIDPostscriptName) + " " + f.Name(truetype.NameIDNameTableVersion)
+		}
+	}
+	return strings.Join(names, "\x00")
+}
+
+// draw renders the equation n with r, encoded in the configured format.
+func (p *processor) draw(n eqdraw.Node, r *eqdraw.Renderer) ([]byte, error) {
+	var fg, bg *image.Uniform
+	if p.opts.Foreground != nil {
+		fg = image.NewUniform(p.opts.Foreground)
+	}
+	if p.opts.Background != nil {
+		bg = image.NewUniform(p.opts.Background)
+	}
+
+	var buf bytes.Buffer
+	if p.opts.Format == "svg" {
+		if err := r.DrawSVG(&buf, n, fg, bg); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	}
+	img, err := r.DrawRGBA(n, fg, bg)
+	if err != nil {
+		return nil, err
+	}
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// escapeLink percent-encodes the bytes of s which may not appear in the
+// destination of a Markdown link, such as spaces and parentheses.
+func escapeLink(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case c <= ' ' || c >= 0x7f, c == '(', c == ')', c == '<', c == '>', c == '\\':
+			fmt.Fprintf(&b, "%%%02X", c)
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+// escapeAlt escapes the characters of s which are special within the alt
+// text of a Markdown image.
+func escapeAlt(s string) string {
+	var b strings.Builder
+	for _, c := range s {
+		switch c {
+		case '\\', '[', ']', '*', '_', '`':
+			b.WriteByte('\\')
+		}
+		b.WriteRune(c)
+	}
+	return b.String()
+}
@@ -0,0 +1,188 @@
+package markdown
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/png"
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"testing"
+
+	"github.com/golang/freetype/truetype"
+	"github.com/google/go-cmp/cmp"
+	"github.com/twitchyliquid64/eqdraw"
+)
+
+func TestProcess(t *testing.T) {
+	tcs := []struct {
+		name, in, want string
+	}{
+		{
+			name: "inline",
+			in:   "The line $y = mx + b$ is straight.\n",
+			want: "The line ![y = mx + b](IMG) is straight.\n",
+		},
+		{
+			name: "display",
+			in:   "Hence\n\n$$\nx = 1/2\n$$\n",
+			want: "Hence\n\n![x = 1/2](IMG)\n",
+		},
+		{
+			name: "alt escaped",
+			in:   "$x_i^2$",
+			want: `![x\_i^2](IMG)`,
+		},
+		{
+			name: "prices",
+			in:   "It costs $5 or $10, and $ 1 + 2 $ is not math.\n",
+			want: "It costs $5 or $10, and $ 1 + 2 $ is not math.\n",
+		},
+		{
+			name: "escaped",
+			in:   `\$x\$ and $x$`,
+			want: `\$x\$ and ![x](IMG)`,
+		},
+		{
+			name: "code span",
+			in:   "Use `$x$` or ``$`y`$`` for $x$.\n",
+			want: "Use `$x$` or ``$`y`$`` for ![x](IMG).\n",
+		},
+		{
+			name: "fenced code",
+			in:   "```sh\necho $x$\n```\n~~~~\n$y$\n~~~~\n$z$\n",
+			want: "```sh\necho $x$\n```\n~~~~\n$y$\n~~~~\n![z](IMG)\n",
+		},
+		{
+			name: "indented code",
+			in:   "Text $a$\n\n    $b$\n\n    $c$\nmore $d$\n",
+			want: "Text ![a](IMG)\n\n    $b$\n\n    $c$\nmore ![d](IMG)\n",
+		},
+		{
+			name: "not across paragraphs",
+			in:   "$a\n\nb$\n",
+			want: "$a\n\nb$\n",
+		},
+	}
+
+	img := regexp.MustCompile(`\(assets/eq-[0-9a-f]{16}\.png\)`)
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			dir := t.TempDir()
+			out, err := Process([]byte(tc.in), Options{AssetsDir: filepath.Join(dir, "assets"), LinkPrefix: "assets"})
+			if err != nil {
+				t.Fatalf("Process() failed: %v", err)
+			}
+			if diff := cmp.Diff(img.ReplaceAllString(string(out), "(IMG)"), tc.want); diff != "" {
+				t.Errorf("output differed:\n%s", diff)
+			}
+
+			// An image should have been written for each link.
+			links := img.FindAllString(string(out), -1)
+			for _, l := range links {
+				if _, err := ioutil.ReadFile(filepath.Join(dir, l[1:len(l)-1])); err != nil {
+					t.Errorf("reading image: %v", err)
+				}
+			}
+		})
+	}
+}
+
+func TestProcessError(t *testing.T) {
+	_, err := Process([]byte("Fine $x$\n\nBroken $1 + (2$\n"), Options{AssetsDir: t.TempDir(), Format: "svg"})
+	var mdErr *Error
+	if !errors.As(err, &mdErr) || mdErr.Line != 3 {
+		t.Fatalf("err = %v, want an error on line 3", err)
+	}
+	var pe *eqdraw.ParseError
+	if !errors.As(err, &pe) || pe.Pos != 5 {
+		t.Errorf("err = %v, want a parse error at position 5", err)
+	}
+}
+
+func TestProcessLinks(t *testing.T) {
+	tcs := []struct {
+		name, dir, prefix string
+		want              *regexp.Regexp
+	}{
+		{
+			name:   "url prefix",
+			prefix: "https://cdn.example.com/eq/",
+			want:   regexp.MustCompile(`^!\[x\]\(https://cdn\.example\.com/eq/eq-[0-9a-f]{16}\.png\)$`),
+		},
+		{
+			name: "special characters",
+			dir:  "my (math) assets",
+			want: regexp.MustCompile(`^!\[x\]\(.*/my%20%28math%29%20assets/eq-[0-9a-f]{16}\.png\)$`),
+		},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			dir := filepath.Join(t.TempDir(), tc.dir)
+			out, err := Process([]byte("$x$"), Options{AssetsDir: dir, LinkPrefix: tc.prefix})
+			if err != nil {
+				t.Fatalf("Process() failed: %v", err)
+			}
+			if !tc.want.Match(out) {
+				t.Errorf("output = %q, want a match for %v", out, tc.want)
+			}
+		})
+	}
+}
+
+func TestProcessStyles(t *testing.T) {
+	r, err := eqdraw.NewRenderer(truetype.Options{Size: 24}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	img := regexp.MustCompile(`\(\./(eq-[0-9a-f]{16}\.png)\)`)
+	process := func(in string, r *eqdraw.Renderer) []image.Image {
+		t.Helper()
+		dir := t.TempDir()
+		out, err := Process([]byte(in), Options{Renderer: r, AssetsDir: dir, LinkPrefix: "."})
+		if err != nil {
+			t.Fatalf("Process() failed: %v", err)
+		}
+		var imgs []image.Image
+		for _, m := range img.FindAllStringSubmatch(string(out), -1) {
+			data, err := ioutil.ReadFile(filepath.Join(dir, m[1]))
+			if err != nil {
+				t.Fatal(err)
+			}
+			i, err := png.Decode(bytes.NewReader(data))
+			if err != nil {
+				t.Fatal(err)
+			}
+			imgs = append(imgs, i)
+		}
+		return imgs
+	}
+
+	// Display math draws the limits of sums above and below them.
+	imgs := process("$sum(i, n, i)$ and $$sum(i, n, i)$$", r)
+	if len(imgs) != 2 {
+		t.Fatalf("got %d images, want 2", len(imgs))
+	}
+	if inline, display := imgs[0].Bounds().Dy(), imgs[1].Bounds().Dy(); display <= inline {
+		t.Errorf("display height = %d, want taller than inline height %d", display, inline)
+	}
+
+	// Images are named after everything which changes how they are drawn.
+	bold, err := eqdraw.DefaultFontBold()
+	if err != nil {
+		t.Fatal(err)
+	}
+	boldRenderer, err := eqdraw.NewRenderer(truetype.Options{Size: 24}, &eqdraw.FontSet{Regular: bold})
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := processor{opts: Options{Format: "png"}}
+	names := map[string]bool{}
+	for _, r := range []*eqdraw.Renderer{r, r.WithInline(true), r.WithPadding(4), r.WithSize(12), boldRenderer} {
+		names[p.fileName("x", r)] = true
+	}
+	if len(names) != 5 {
+		t.Errorf("file names = %v, want 5 distinct names", names)
+	}
+}
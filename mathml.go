@@ -0,0 +1,313 @@
+package eqdraw
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+	"unicode"
+)
+
+// mathmlNS is the namespace of MathML elements.
+const mathmlNS = "http://www.w3.org/1998/Math/MathML"
+
+// mathmlVariants maps font styles to the mathvariant attribute of a token
+// element.
+var mathmlVariants = map[FontStyle]string{
+	StyleRegular:    "normal",
+	StyleItalic:     "italic",
+	StyleBold:       "bold",
+	StyleBoldItalic: "bold-italic",
+}
+
+// mathmlWriter accumulates the MathML for a node tree.
+type mathmlWriter struct {
+	buf bytes.Buffer
+}
+
+// WriteMathML writes the node tree n to w as a Presentation MathML <math>
+// element. If display is true, the element is marked to be displayed as a
+// block rather than inline. An error is returned if the tree contains a
+// node which has no MathML equivalent, such as a custom node.
+func WriteMathML(w io.Writer, n Node, display bool) error {
+	var mw mathmlWriter
+	mw.buf.WriteString(`<math xmlns="` + mathmlNS + `"`)
+	if display {
+		mw.buf.WriteString(` display="block"`)
+	}
+	mw.buf.WriteString(">")
+	if err := mw.node(n); err != nil {
+		return err
+	}
+	mw.buf.WriteString("</math>")
+
+	_, err := mw.buf.WriteTo(w)
+	return err
+}
+
+// MathML returns the node tree n as a Presentation MathML <math> element,
+// to be displayed inline.
+func MathML(n Node) (string, error) {
+	var buf bytes.Buffer
+	if err := WriteMathML(&buf, n, false); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// element writes an element named name, with the given children.
+func (mw *mathmlWriter) element(name string, children ...Node) error {
+	mw.buf.WriteString("<" + name + ">")
+	for _, c := range children {
+		if err := mw.node(c); err != nil {
+			return err
+		}
+	}
+	mw.buf.WriteString("</" + name + ">")
+	return nil
+}
+
+// token writes a token element, such as <mi>, containing text.
+func (mw *mathmlWriter) token(name, variant string, text []rune) {
+	mw.buf.WriteString("<" + name)
+	if variant != "" {
+		mw.buf.WriteString(` mathvariant="` + variant + `"`)
+	}
+	mw.buf.WriteString(">")
+	xml.EscapeText(&mw.buf, []byte(string(text)))
+	mw.buf.WriteString("</" + name + ">")
+}
+
+func (mw *mathmlWriter) node(n Node) error {
+	switch n := n.(type) {
+	case nil:
+		mw.buf.WriteString("<mrow></mrow>")
+	case *Term:
+		mw.term(n)
+	case *Run:
+		return mw.element("mrow", n.Terms...)
+	case *Div:
+		return mw.element("mfrac", n.Numerator, n.Denominator)
+	case *Root:
+		if n.Index != nil {
+			return mw.element("mroot", n.Term, n.Index)
+		}
+		return mw.element("msqrt", n.Term)
+	case *Parenthesis:
+		mw.buf.WriteString(`<mrow><mo fence="true">(</mo>`)
+		if n.Term != nil {
+			if err := mw.node(n.Term); err != nil {
+				return err
+			}
+		}
+		mw.buf.WriteString(`<mo fence="true">)</mo></mrow>`)
+	case *BigOp:
+		return mw.bigOp(n)
+	case *Matrix:
+		return mw.matrix(n)
+	case *Sup:
+		return mw.element("msup", n.Base, n.Exponent)
+	case *Sub:
+		if n.Exponent != nil {
+			return mw.element("msubsup", n.Base, n.Index, n.Exponent)
+		}
+		return mw.element("msub", n.Base, n.Index)
+	default:
+		return fmt.Errorf("mathml: unsupported node type %T", n)
+	}
+	return nil
+}
+
+// bigOp writes a large operator, and its body. The limits of integrals are
+// written as scripts, and those of other operators above and below them.
+func (mw *mathmlWriter) bigOp(b *BigOp) error {
+	mw.buf.WriteString("<mrow>")
+	under, over, both := "munder", "mover", "munderover"
+	if isIntegral(b.Op) {
+		under, over, both = "msub", "msup", "msubsup"
+	}
+	var name string
+	switch {
+	case b.Lower != nil && b.Upper != nil:
+		name = both
+	case b.Lower != nil:
+		name = under
+	case b.Upper != nil:
+		name = over
+	}
+
+	if name != "" {
+		mw.buf.WriteString("<" + name + ">")
+	}
+	mw.token("mo", "", []rune{b.Op})
+	for _, l := range []Node{b.Lower, b.Upper} {
+		if l != nil {
+			if err := mw.node(l); err != nil {
+				return err
+			}
+		}
+	}
+	if name != "" {
+		mw.buf.WriteString("</" + name + ">")
+	}
+
+	if _, ok := b.Body.(*Term); ok && hasRelation(b.Body) {
+		// A lone relation would otherwise end the body when parsed.
+		if err := mw.element("mrow", b.Body); err != nil {
+			return err
+		}
+	} else if b.Body != nil {
+		if err := mw.node(b.Body); err != nil {
+			return err
+		}
+	}
+	mw.buf.WriteString("</mrow>")
+	return nil
+}
+
+// mathmlAlignments maps alignments to the values of the columnalign
+// attribute.
+var mathmlAlignments = map[Alignment]string{
+	AlignLeft:   "left",
+	AlignCenter: "center",
+	AlignRight:  "right",
+}
+
+// matrix writes a matrix as an <mtable>, within an <mrow> with its
+// delimiters if it has any.
+func (mw *mathmlWriter) matrix(m *Matrix) error {
+	open, close := m.Delims.runes()
+	if open != 0 {
+		mw.buf.WriteString("<mrow>")
+		mw.token("mo", "", []rune{open})
+	}
+
+	mw.buf.WriteString("<mtable")
+	if n := m.columns(); len(m.Align) > 0 && n > 0 {
+		align := make([]string, n)
+		for i := range align {
+			align[i] = mathmlAlignments[m.align(i)]
+		}
+		mw.buf.WriteString(` columnalign="` + strings.Join(align, " ") + `"`)
+	}
+	if m.RowGap != 0 {
+		fmt.Fprintf(&mw.buf, ` rowspacing="%gem"`, m.RowGap)
+	}
+	if m.ColumnGap != 0 {
+		fmt.Fprintf(&mw.buf, ` columnspacing="%gem"`, m.ColumnGap)
+	}
+	mw.buf.WriteString(">")
+	for _, row := range m.Rows {
+		mw.buf.WriteString("<mtr>")
+		for _, c := range row {
+			mw.buf.WriteString("<mtd>")
+			if c != nil {
+				if err := mw.node(c); err != nil {
+					return err
+				}
+			}
+			mw.buf.WriteString("</mtd>")
+		}
+		mw.buf.WriteString("</mtr>")
+	}
+	mw.buf.WriteString("</mtable>")
+
+	if open != 0 {
+		mw.token("mo", "", []rune{close})
+		mw.buf.WriteString("</mrow>")
+	}
+	return nil
+}
+
+// termToken is a token element within a term.
+type termToken struct {
+	name    string // One of mi, mn or mo.
+	variant string
+	text    []rune
+}
+
+// termTokens splits the content of a term into numbers, identifiers and
+// operators. A run of letters is a single identifier, so multi-letter
+// names such as sin are kept together.
+func termTokens(t *Term) []termToken {
+	var out []termToken
+	for i := 0; i < len(t.Content); {
+		c := t.Content[i]
+		j := i + 1
+		var tok termToken
+		switch {
+		case unicode.IsDigit(c) || (c == '.' && j < len(t.Content) && unicode.IsDigit(t.Content[j])):
+			for j < len(t.Content) && (unicode.IsDigit(t.Content[j]) || t.Content[j] == '.') {
+				j++
+			}
+			tok.name = "mn"
+		case unicode.IsLetter(c):
+			for j < len(t.Content) && unicode.IsLetter(t.Content[j]) {
+				j++
+			}
+			tok.name = "mi"
+		default:
+			tok.name = "mo"
+		}
+		tok.text = t.Content[i:j]
+		tok.variant = mathmlVariant(t.Style, tok)
+		out = append(out, tok)
+		i = j
+	}
+	return out
+}
+
+// mathmlVariant returns the mathvariant attribute a token needs to match
+// the style it is drawn in, or the empty string if the MathML default
+// matches.
+func mathmlVariant(s FontStyle, tok termToken) string {
+	if s == StyleAuto {
+		// Only latin lowercase letters are drawn in italic.
+		s = StyleRegular
+		if tok.name == "mi" {
+			s = StyleItalic
+			for _, c := range tok.text {
+				if c < 'a' || c > 'z' {
+					s = StyleRegular
+				}
+			}
+		}
+	}
+
+	// Identifiers of a single character default to italic, and all other
+	// tokens to normal.
+	def := StyleRegular
+	if tok.name == "mi" && len(tok.text) == 1 {
+		def = StyleItalic
+	}
+	if s == def {
+		return ""
+	}
+	return mathmlVariants[s]
+}
+
+func (mw *mathmlWriter) term(t *Term) {
+	for _, c := range t.Content {
+		if unicode.IsSpace(c) {
+			// Terms containing spaces are text, such as from \text{...}.
+			variant := mathmlVariants[t.Style]
+			if t.Style == StyleRegular {
+				variant = ""
+			}
+			mw.token("mtext", variant, t.Content)
+			return
+		}
+	}
+
+	toks := termTokens(t)
+	if len(toks) != 1 {
+		mw.buf.WriteString("<mrow>")
+	}
+	for _, tok := range toks {
+		mw.token(tok.name, tok.variant, tok.text)
+	}
+	if len(toks) != 1 {
+		mw.buf.WriteString("</mrow>")
+	}
+}
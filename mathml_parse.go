@@ -0,0 +1,482 @@
+package eqdraw
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// mathmlElem is an element of a MathML document.
+type mathmlElem struct {
+	name     string
+	attrs    map[string]string // Attributes, by local name.
+	children []*mathmlElem
+	text     strings.Builder
+	// pos is the position of the start tag in the input, counted in runes
+	// and starting from 1.
+	pos int
+	// off is the offset of the start tag in bytes, and n is its length in
+	// runes.
+	off, n int
+}
+
+// errorf returns a ParseError for the start tag of the element.
+func (e *mathmlElem) errorf(kind ErrorKind, format string, args ...interface{}) error {
+	return &ParseError{Pos: e.pos, Offset: e.off, Len: e.n, Kind: kind, Msg: fmt.Sprintf(format, args...)}
+}
+
+// mathmlInvisible are the invisible operators, such as invisible times,
+// which are dropped rather than drawn.
+var mathmlInvisible = map[string]bool{
+	"\u2061": true, "\u2062": true, "\u2063": true, "\u2064": true,
+}
+
+// mathmlEntity holds the named character references accepted in MathML:
+// those of HTML, and those used by MathML for invisible operators.
+var mathmlEntity = func() map[string]string {
+	out := map[string]string{
+		"ApplyFunction":  "\u2061",
+		"af":             "\u2061",
+		"InvisibleTimes": "\u2062",
+		"it":             "\u2062",
+		"InvisibleComma": "\u2063",
+		"ic":             "\u2063",
+		"PlusMinus":      "±",
+		"MinusPlus":      "∓",
+		"CenterDot":      "·",
+	}
+	for k, v := range xml.HTMLEntity {
+		out[k] = v
+	}
+	return out
+}()
+
+// readMathML decodes the elements of a MathML document.
+func readMathML(data []byte) (*mathmlElem, error) {
+	d := xml.NewDecoder(bytes.NewReader(data))
+	d.Entity = mathmlEntity
+
+	var (
+		root  *mathmlElem
+		stack []*mathmlElem
+	)
+	for {
+		off := d.InputOffset()
+		tok, err := d.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		switch tok := tok.(type) {
+		case xml.StartElement:
+			end := int(d.InputOffset())
+			e := &mathmlElem{
+				name: tok.Name.Local,
+				pos:  utf8.RuneCount(data[:off]) + 1,
+				off:  int(off),
+				n:    utf8.RuneCount(data[off:end]),
+			}
+			for _, a := range tok.Attr {
+				if e.attrs == nil {
+					e.attrs = map[string]string{}
+				}
+				e.attrs[a.Name.Local] = a.Value
+			}
+			if len(stack) > 0 {
+				parent := stack[len(stack)-1]
+				parent.children = append(parent.children, e)
+			} else if root == nil {
+				root = e
+			}
+			stack = append(stack, e)
+		case xml.EndElement:
+			stack = stack[:len(stack)-1]
+		case xml.CharData:
+			if len(stack) > 0 {
+				stack[len(stack)-1].text.Write(tok)
+			}
+		}
+	}
+	if root == nil {
+		return nil, &ParseError{Pos: 1, Kind: KindUnexpected, Msg: "no MathML element"}
+	}
+	return root, nil
+}
+
+// ParseMathML generates the node tree for a Presentation MathML document.
+// The supported elements are <math>, <mrow>, <mi>, <mn>, <mo>, <mtext>,
+// <mfrac>, <msqrt>, <mroot>, <msup>, <msub>, <msubsup> and <mtable>. Parentheses
+// written as <mo> elements are drawn as a Parenthesis around the elements
+// between them, except around a lone <mtable>, which is drawn as a Matrix
+// with those delimiters. Large operators, such as an <mo>∑</mo> within
+// <munderover>, are drawn as a BigOp applied to the rest of their sequence,
+// up to the next relation such as <mo>=</mo>. Unsupported elements are
+// reported with a *ParseError, giving the position of the element in the
+// input.
+func ParseMathML(r io.Reader) (Node, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	root, err := readMathML(data)
+	if err != nil {
+		return nil, locateError(err, string(data))
+	}
+	n, err := mathmlNode(root)
+	return n, locateError(err, string(data))
+}
+
+// mathmlNode converts an element to a node. The returned node is nil for
+// elements which draw nothing, such as an empty <mrow>.
+func mathmlNode(e *mathmlElem) (Node, error) {
+	switch e.name {
+	case "math", "mrow", "mstyle":
+		if m, err := mathmlDelimited(e); m != nil || err != nil {
+			return m, err
+		}
+		return mathmlSeq(e.children)
+
+	case "mtable":
+		return mathmlMatrix(e)
+
+	case "semantics":
+		// The first child is the presentation markup, and the rest are
+		// annotations.
+		if len(e.children) == 0 {
+			return nil, nil
+		}
+		return mathmlNode(e.children[0])
+
+	case "mi", "mn", "mo", "mtext":
+		text := strings.Join(strings.Fields(e.text.String()), " ")
+		if e.name == "mtext" {
+			text = e.text.String()
+		}
+		if text == "" || (e.name == "mo" && mathmlInvisible[text]) {
+			return nil, nil
+		}
+		return &Term{Content: []rune(text), Style: mathmlStyle(e, text)}, nil
+
+	case "mfrac":
+		args, err := mathmlArgs(e, 2)
+		if err != nil {
+			return nil, err
+		}
+		return &Div{Numerator: args[0], Denominator: args[1]}, nil
+
+	case "msqrt":
+		n, err := mathmlSeq(e.children)
+		if err != nil {
+			return nil, err
+		}
+		if n == nil {
+			return nil, e.errorf(KindMissingOperand, "empty <msqrt>")
+		}
+		return &Root{Term: n}, nil
+
+	case "mroot":
+		args, err := mathmlArgs(e, 2)
+		if err != nil {
+			return nil, err
+		}
+		return &Root{Term: args[0], Index: args[1]}, nil
+
+	case "msup":
+		args, err := mathmlArgs(e, 2)
+		if err != nil {
+			return nil, err
+		}
+		return &Sup{Base: args[0], Exponent: args[1]}, nil
+
+	case "msub":
+		args, err := mathmlArgs(e, 2)
+		if err != nil {
+			return nil, err
+		}
+		return &Sub{Base: args[0], Index: args[1]}, nil
+
+	case "msubsup":
+		args, err := mathmlArgs(e, 3)
+		if err != nil {
+			return nil, err
+		}
+		return &Sub{Base: args[0], Index: args[1], Exponent: args[2]}, nil
+	}
+	return nil, e.errorf(KindUnsupported, "unsupported MathML element <%s>", e.name)
+}
+
+// mathmlArgs converts the children of an element which takes a fixed
+// number of arguments, such as <mfrac>.
+func mathmlArgs(e *mathmlElem, want int) ([]Node, error) {
+	if len(e.children) != want {
+		kind := KindMissingOperand
+		if len(e.children) > want {
+			kind = KindUnexpected
+		}
+		return nil, e.errorf(kind, "<%s> has %d children, want %d", e.name, len(e.children), want)
+	}
+	out := make([]Node, want)
+	for i, c := range e.children {
+		n, err := mathmlNode(c)
+		if err != nil {
+			return nil, err
+		}
+		if n == nil {
+			return nil, c.errorf(KindMissingOperand, "empty argument to <%s>", e.name)
+		}
+		out[i] = n
+	}
+	return out, nil
+}
+
+// mathmlBigOps are the operators which are drawn as a BigOp when written
+// as an <mo>.
+var mathmlBigOps = func() map[rune]bool {
+	out := map[rune]bool{}
+	for _, r := range latexBigOps {
+		out[r] = true
+	}
+	return out
+}()
+
+// isMathMLBigOp returns true if e is an <mo> containing a large operator.
+func isMathMLBigOp(e *mathmlElem) bool {
+	text := []rune(strings.TrimSpace(e.text.String()))
+	return e.name == "mo" && len(text) == 1 && mathmlBigOps[text[0]]
+}
+
+// mathmlBigOp converts an element to a large operator without a body,
+// returning nil if it is not one. Large operators are written as an <mo>,
+// with any limits as scripts or under and over it.
+func mathmlBigOp(e *mathmlElem) (*BigOp, error) {
+	var base *mathmlElem
+	switch e.name {
+	case "mo":
+		base = e
+	case "munder", "mover", "munderover", "msub", "msup", "msubsup":
+		if len(e.children) > 0 {
+			base = e.children[0]
+		}
+	}
+	if base == nil || !isMathMLBigOp(base) {
+		return nil, nil
+	}
+	out := &BigOp{Op: []rune(strings.TrimSpace(base.text.String()))[0]}
+
+	var err error
+	var args []Node
+	switch e.name {
+	case "munder", "msub":
+		if args, err = mathmlArgs(e, 2); err == nil {
+			out.Lower = args[1]
+		}
+	case "mover", "msup":
+		if args, err = mathmlArgs(e, 2); err == nil {
+			out.Upper = args[1]
+		}
+	case "munderover", "msubsup":
+		if args, err = mathmlArgs(e, 3); err == nil {
+			out.Lower, out.Upper = args[1], args[2]
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// mathmlMatrix converts an <mtable> to a matrix without delimiters.
+func mathmlMatrix(e *mathmlElem) (*Matrix, error) {
+	out := &Matrix{}
+	for _, a := range strings.Fields(e.attrs["columnalign"]) {
+		var align Alignment
+		for al, name := range mathmlAlignments {
+			if name == a {
+				align = al
+			}
+		}
+		out.Align = append(out.Align, align)
+	}
+	out.RowGap = mathmlEms(e.attrs["rowspacing"])
+	out.ColumnGap = mathmlEms(e.attrs["columnspacing"])
+
+	for _, tr := range e.children {
+		if tr.name != "mtr" {
+			return nil, tr.errorf(KindUnsupported, "unsupported MathML element <%s> in <mtable>", tr.name)
+		}
+		var row []Node
+		for _, td := range tr.children {
+			if td.name != "mtd" {
+				return nil, td.errorf(KindUnsupported, "unsupported MathML element <%s> in <mtr>", td.name)
+			}
+			n, err := mathmlSeq(td.children)
+			if err != nil {
+				return nil, err
+			}
+			row = append(row, n)
+		}
+		out.Rows = append(out.Rows, row)
+	}
+	return out, nil
+}
+
+// mathmlEms returns the length of a spacing attribute in ems, or zero if it
+// is not a single length in ems.
+func mathmlEms(s string) float64 {
+	if !strings.HasSuffix(s, "em") {
+		return 0
+	}
+	v, err := strconv.ParseFloat(strings.TrimSuffix(s, "em"), 64)
+	if err != nil || v < 0 {
+		return 0
+	}
+	return v
+}
+
+// mathmlDelimited converts an <mrow> containing only an <mtable> between
+// delimiters to a matrix with those delimiters. It returns nil if e is not
+// such an <mrow>.
+func mathmlDelimited(e *mathmlElem) (*Matrix, error) {
+	c := e.children
+	if len(c) != 3 || c[0].name != "mo" || c[1].name != "mtable" || c[2].name != "mo" {
+		return nil, nil
+	}
+	open, close := strings.TrimSpace(c[0].text.String()), strings.TrimSpace(c[2].text.String())
+	for d := DelimParens; d <= DelimDoubleBars; d++ {
+		if o, cl := d.runes(); string(o) == open && string(cl) == close {
+			m, err := mathmlMatrix(c[1])
+			if err != nil {
+				return nil, err
+			}
+			m.Delims = d
+			return m, nil
+		}
+	}
+	return nil, nil
+}
+
+// isMathMLParen returns true if e is an <mo> containing the parenthesis p.
+func isMathMLParen(e *mathmlElem, p string) bool {
+	return e.name == "mo" && strings.TrimSpace(e.text.String()) == p
+}
+
+// mathmlBodyEnd returns the index of the first relation in elems from
+// start, outside any parentheses, or len(elems) if there is none.
+func mathmlBodyEnd(elems []*mathmlElem, start int) int {
+	depth := 0
+	for i := start; i < len(elems); i++ {
+		e := elems[i]
+		switch {
+		case isMathMLParen(e, "("):
+			depth++
+		case isMathMLParen(e, ")"):
+			depth--
+		case depth <= 0 && e.name == "mo":
+			if text := []rune(strings.TrimSpace(e.text.String())); len(text) == 1 && isRelation(text[0]) {
+				return i
+			}
+		}
+	}
+	return len(elems)
+}
+
+// mathmlSeq converts a sequence of elements, grouping the elements between
+// matching parentheses into a Parenthesis.
+func mathmlSeq(elems []*mathmlElem) (Node, error) {
+	var out []Node
+	for i := 0; i < len(elems); i++ {
+		if isMathMLParen(elems[i], "(") {
+			depth, end := 0, -1
+			for j := i; j < len(elems) && end < 0; j++ {
+				switch {
+				case isMathMLParen(elems[j], "("):
+					depth++
+				case isMathMLParen(elems[j], ")"):
+					if depth--; depth == 0 {
+						end = j
+					}
+				}
+			}
+			if end >= 0 {
+				inner, err := mathmlSeq(elems[i+1 : end])
+				if err != nil {
+					return nil, err
+				}
+				out = append(out, &Parenthesis{Term: inner})
+				i = end
+				continue
+			}
+		}
+
+		// The body of a large operator is the rest of the sequence, up to
+		// the next relation outside parentheses.
+		b, err := mathmlBigOp(elems[i])
+		if err != nil {
+			return nil, err
+		}
+		if b != nil {
+			end := mathmlBodyEnd(elems, i+1)
+			if b.Body, err = mathmlSeq(elems[i+1 : end]); err != nil {
+				return nil, err
+			}
+			out = append(out, b)
+			i = end - 1
+			continue
+		}
+
+		n, err := mathmlNode(elems[i])
+		if err != nil {
+			return nil, err
+		}
+		if n != nil {
+			out = append(out, n)
+		}
+	}
+	return seqNode(out), nil
+}
+
+// mathmlStyle returns the style to draw the text of a token element with.
+// Where the style of the token matches the way StyleAuto would draw it,
+// StyleAuto is used.
+func mathmlStyle(e *mathmlElem, text string) FontStyle {
+	lower := true // All letters are latin lowercase.
+	for _, c := range text {
+		if c < 'a' || c > 'z' {
+			lower = false
+		}
+	}
+	hasLower := strings.IndexFunc(text, func(c rune) bool { return c >= 'a' && c <= 'z' }) >= 0
+
+	variant := e.attrs["mathvariant"]
+	if variant == "" {
+		switch {
+		case e.name == "mi" && utf8.RuneCountInString(text) == 1:
+			variant = "italic"
+		default:
+			variant = "normal"
+		}
+	}
+	switch variant {
+	case "italic":
+		if lower {
+			return StyleAuto
+		}
+		return StyleItalic
+	case "bold":
+		return StyleBold
+	case "bold-italic":
+		return StyleBoldItalic
+	}
+	if !hasLower {
+		return StyleAuto
+	}
+	return StyleRegular
+}
@@ -0,0 +1,318 @@
+package eqdraw
+
+import (
+	"bytes"
+	"encoding/xml"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestMathML(t *testing.T) {
+	tcs := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{
+			name:  "line",
+			input: "y = mx + 2.5",
+			want:  `<mrow><mi>y</mi><mo>=</mo><mi mathvariant="italic">mx</mi><mo>+</mo><mn>2.5</mn></mrow>`,
+		},
+		{
+			name:  "mixed term",
+			input: "2x",
+			want:  `<mrow><mn>2</mn><mi>x</mi></mrow>`,
+		},
+		{
+			name:  "div and root",
+			input: "1/sqrt(x^2 + 1)",
+			want:  `<mfrac><mn>1</mn><msqrt><mrow><msup><mi>x</mi><mn>2</mn></msup><mo>+</mo><mn>1</mn></mrow></msqrt></mfrac>`,
+		},
+		{
+			name:  "nth root",
+			input: "root(3, x)",
+			want:  `<mroot><mi>x</mi><mn>3</mn></mroot>`,
+		},
+		{
+			name:  "parentheses",
+			input: "2(a_i^2)",
+			want:  `<mrow><mn>2</mn><mrow><mo fence="true">(</mo><msubsup><mi>a</mi><mi>i</mi><mn>2</mn></msubsup><mo fence="true">)</mo></mrow></mrow>`,
+		},
+		{
+			name:  "sub",
+			input: "x_(n+1)",
+			want:  `<msub><mi>x</mi><mrow><mi>n</mi><mo>+</mo><mn>1</mn></mrow></msub>`,
+		},
+		{
+			name:  "escaped",
+			input: "'a<b'",
+			want:  `<mrow><mi>a</mi><mo>&lt;</mo><mi>b</mi></mrow>`,
+		},
+		{
+			name:  "upright capital",
+			input: "A",
+			want:  `<mi mathvariant="normal">A</mi>`,
+		},
+		{
+			name:  "sum",
+			input: "sum(i=1, n, i) + prod(k)",
+			want:  `<mrow><mrow><munderover><mo>∑</mo><mrow><mi>i</mi><mo>=</mo><mn>1</mn></mrow><mi>n</mi></munderover><mi>i</mi></mrow><mo>+</mo><mrow><mo>∏</mo><mi>k</mi></mrow></mrow>`,
+		},
+		{
+			name:  "matrix",
+			input: "[[1, x], [, y]]",
+			want:  `<mrow><mo>[</mo><mtable><mtr><mtd><mn>1</mn></mtd><mtd><mi>x</mi></mtd></mtr><mtr><mtd></mtd><mtd><mi>y</mi></mtd></mtr></mtable><mo>]</mo></mrow>`,
+		},
+		{
+			name:  "integral",
+			input: "int(0, x dx)",
+			want:  `<mrow><msub><mo>∫</mo><mn>0</mn></msub><mrow><mi>x</mi><mi mathvariant="italic">dx</mi></mrow></mrow>`,
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			n, err := ParseASCIIEquation(tc.input)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := MathML(n)
+			if err != nil {
+				t.Fatalf("MathML() failed: %v", err)
+			}
+			if want := `<math xmlns="http://www.w3.org/1998/Math/MathML">` + tc.want + `</math>`; got != want {
+				t.Errorf("MathML() = %s\nwant %s", got, want)
+			}
+			if err := xml.Unmarshal([]byte(got), new(struct{})); err != nil {
+				t.Errorf("output is not valid XML: %v", err)
+			}
+		})
+	}
+}
+
+func TestMathMLStyles(t *testing.T) {
+	n, err := ParseLaTeX(`\sin\theta + \text{if } \mathbf{v}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := WriteMathML(&buf, n, true); err != nil {
+		t.Fatalf("WriteMathML() failed: %v", err)
+	}
+	want := `<math xmlns="http://www.w3.org/1998/Math/MathML" display="block"><mrow><mi>sin</mi><mi mathvariant="normal">θ</mi><mo>+</mo><mtext>if </mtext><mi mathvariant="bold">v</mi></mrow></math>`
+	if got := buf.String(); got != want {
+		t.Errorf("WriteMathML() = %s\nwant %s", got, want)
+	}
+
+	if _, err := MathML(Seq(Text("a"), &boxNode{})); err == nil {
+		t.Error("MathML() with a custom node succeeded, want error")
+	}
+}
+
+func TestParseMathML(t *testing.T) {
+	tcs := []struct {
+		name     string
+		input    string
+		expected Node
+		err      *ParseError
+	}{
+		{
+			name:  "fraction",
+			input: `<math><mfrac><mn>1</mn><mrow><mi>x</mi><mo>+</mo><mn>1</mn></mrow></mfrac></math>`,
+			expected: &Div{
+				Numerator:   &Term{Content: []rune("1")},
+				Denominator: &Run{Terms: []Node{&Term{Content: []rune("x")}, &Term{Content: []rune("+")}, &Term{Content: []rune("1")}}},
+			},
+		},
+		{
+			name: "parentheses",
+			input: `<math xmlns="http://www.w3.org/1998/Math/MathML">
+				<mn>2</mn><mo>&InvisibleTimes;</mo>
+				<mrow><mo fence="true">(</mo><mi>a</mi><mo>&times;</mo><mi>b</mi><mo fence="true">)</mo></mrow>
+			</math>`,
+			expected: &Run{Terms: []Node{
+				&Term{Content: []rune("2")},
+				&Parenthesis{Term: &Run{Terms: []Node{&Term{Content: []rune("a")}, &Term{Content: []rune("×")}, &Term{Content: []rune("b")}}}},
+			}},
+		},
+		{
+			name:  "nested parentheses",
+			input: `<mrow><mo>(</mo><mo>(</mo><mi>a</mi><mo>)</mo><mo>)</mo></mrow>`,
+			expected: &Parenthesis{Term: &Parenthesis{
+				Term: &Term{Content: []rune("a")},
+			}},
+		},
+		{
+			name:  "sqrt and scripts",
+			input: `<math><msqrt><msubsup><mi>x</mi><mi>i</mi><mn>2</mn></msubsup><mo>-</mo><msup><mi>y</mi><mn>3</mn></msup></msqrt></math>`,
+			expected: &Root{Term: &Run{Terms: []Node{
+				&Sub{Base: &Term{Content: []rune("x")}, Index: &Term{Content: []rune("i")}, Exponent: &Term{Content: []rune("2")}},
+				&Term{Content: []rune("-")},
+				&Sup{Base: &Term{Content: []rune("y")}, Exponent: &Term{Content: []rune("3")}},
+			}}},
+		},
+		{
+			name:  "mroot",
+			input: `<math><mroot><mrow><mi>x</mi><mo>+</mo><mn>1</mn></mrow><mi>n</mi></mroot></math>`,
+			expected: &Root{
+				Index: &Term{Content: []rune("n")},
+				Term: &Run{Terms: []Node{
+					&Term{Content: []rune("x")},
+					&Term{Content: []rune("+")},
+					&Term{Content: []rune("1")},
+				}},
+			},
+		},
+		{
+			name:  "styles",
+			input: `<math><mi>sin</mi><mi>θ</mi><mi mathvariant="normal">d</mi><mi mathvariant="bold">v</mi><mtext>if </mtext></math>`,
+			expected: &Run{Terms: []Node{
+				&Term{Content: []rune("sin"), Style: StyleRegular},
+				&Term{Content: []rune("θ"), Style: StyleItalic},
+				&Term{Content: []rune("d"), Style: StyleRegular},
+				&Term{Content: []rune("v"), Style: StyleBold},
+				&Term{Content: []rune("if "), Style: StyleRegular},
+			}},
+		},
+		{
+			name:  "big operators",
+			input: `<math><mn>2</mn><mrow><mover><mo>∏</mo><mi>n</mi></mover><mi>k</mi><mo>+</mo><mo>∫</mo><mi>x</mi></mrow></math>`,
+			expected: &Run{Terms: []Node{
+				&Term{Content: []rune("2")},
+				&BigOp{
+					Op:    OpProduct,
+					Upper: &Term{Content: []rune("n")},
+					Body: &Run{Terms: []Node{
+						&Term{Content: []rune("k")},
+						&Term{Content: []rune("+")},
+						&BigOp{Op: OpIntegral, Body: &Term{Content: []rune("x")}},
+					}},
+				},
+			}},
+		},
+		{
+			name:  "big operator before relation",
+			input: `<math><munder><mo>∑</mo><mi>i</mi></munder><mi>i</mi><mo>=</mo><mo>(</mo><mo>∑</mo><mi>j</mi><mo>=</mo><mn>1</mn><mo>)</mo></math>`,
+			expected: &Run{Terms: []Node{
+				&BigOp{Op: OpSum, Lower: &Term{Content: []rune("i")}, Body: &Term{Content: []rune("i")}},
+				&Term{Content: []rune("=")},
+				&Parenthesis{Term: &Run{Terms: []Node{
+					&BigOp{Op: OpSum, Body: &Term{Content: []rune("j")}},
+					&Term{Content: []rune("=")},
+					&Term{Content: []rune("1")},
+				}}},
+			}},
+		},
+		{
+			name:  "big operator in parentheses",
+			input: `<math><mo>(</mo><msubsup><mo>∮</mo><mi>C</mi><mi>D</mi></msubsup><mo>)</mo><mi>y</mi></math>`,
+			expected: &Run{Terms: []Node{
+				&Parenthesis{Term: &BigOp{Op: OpContourIntegral, Lower: &Term{Content: []rune("C"), Style: StyleItalic}, Upper: &Term{Content: []rune("D"), Style: StyleItalic}}},
+				&Term{Content: []rune("y")},
+			}},
+		},
+		{
+			name: "matrix",
+			input: `<math><mrow><mo>|</mo><mtable columnalign="left right" rowspacing="1em" columnspacing="2px">
+				<mtr><mtd><mi>a</mi></mtd><mtd><mi>b</mi><mo>+</mo><mn>1</mn></mtd></mtr>
+				<mtr><mtd><mi>c</mi></mtd></mtr>
+			</mtable><mo>|</mo></mrow></math>`,
+			expected: &Matrix{
+				Rows: [][]Node{
+					{&Term{Content: []rune("a")}, &Run{Terms: []Node{&Term{Content: []rune("b")}, &Term{Content: []rune("+")}, &Term{Content: []rune("1")}}}},
+					{&Term{Content: []rune("c")}},
+				},
+				Align:  []Alignment{AlignLeft, AlignRight},
+				RowGap: 1,
+				Delims: DelimBars,
+			},
+		},
+		{
+			name:  "matrix with unsupported row",
+			input: `<math><mtable><mlabeledtr></mlabeledtr></mtable></math>`,
+			err:   &ParseError{Pos: 15, Offset: 14, Line: 1, Column: 15, Len: 12, Kind: KindUnsupported, Msg: "unsupported MathML element <mlabeledtr> in <mtable>"},
+		},
+		{
+			name:  "unsupported under",
+			input: `<math><munder><mi>x</mi><mo>_</mo></munder></math>`,
+			err:   &ParseError{Pos: 7, Offset: 6, Line: 1, Column: 7, Len: 8, Kind: KindUnsupported, Msg: "unsupported MathML element <munder>"},
+		},
+		{
+			name:  "unsupported",
+			input: "<math>\n  <menclose></menclose></math>",
+			err:   &ParseError{Pos: 10, Offset: 9, Line: 2, Column: 3, Len: 10, Kind: KindUnsupported, Msg: "unsupported MathML element <menclose>"},
+		},
+		{
+			name:  "wrong arguments",
+			input: `<math><mfrac><mn>1</mn></mfrac></math>`,
+			err:   &ParseError{Pos: 7, Offset: 6, Line: 1, Column: 7, Len: 7, Kind: KindMissingOperand, Msg: "<mfrac> has 1 children, want 2"},
+		},
+		{
+			name:  "empty sqrt",
+			input: `<math><msqrt/></math>`,
+			err:   &ParseError{Pos: 7, Offset: 6, Line: 1, Column: 7, Len: 8, Kind: KindMissingOperand, Msg: "empty <msqrt>"},
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			out, err := ParseMathML(strings.NewReader(tc.input))
+			if tc.err != nil {
+				if diff := cmp.Diff(err, error(tc.err)); diff != "" {
+					t.Errorf("err differed:\n%s", diff)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseMathML() failed: %v", err)
+			}
+			if diff := cmp.Diff(out, tc.expected); diff != "" {
+				t.Errorf("output differed:\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestMathMLMatrixRoundTrip(t *testing.T) {
+	for d := DelimNone; d <= DelimDoubleBars; d++ {
+		m := &Matrix{
+			Rows:      [][]Node{{&Term{Content: []rune("a")}, nil}, {&Term{Content: []rune("c")}}},
+			Align:     []Alignment{AlignRight},
+			ColumnGap: 0.25,
+			Delims:    d,
+		}
+		want, err := MathML(m)
+		if err != nil {
+			t.Fatal(err)
+		}
+		parsed, err := ParseMathML(strings.NewReader(want))
+		if err != nil {
+			t.Fatalf("ParseMathML(%q) failed: %v", want, err)
+		}
+		if got, err := MathML(parsed); err != nil || got != want {
+			t.Errorf("round trip of %s = %s, %v", want, got, err)
+		}
+	}
+}
+
+func TestMathMLRoundTrip(t *testing.T) {
+	for _, inp := range []string{"y = mx + 2.5", "1/sqrt(x^2 + 1)", "2(a_i^2)", "A + 'a<b'", "sum(i, n, i) - int(, 1, x)", "[[a, b], [c]]^2", "root(n+1, x) - ∛2", "sum(i, n, i = 1) = prod(k, , '=')"} {
+		n, err := ParseASCIIEquation(inp)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want, err := MathML(n)
+		if err != nil {
+			t.Fatal(err)
+		}
+		parsed, err := ParseMathML(strings.NewReader(want))
+		if err != nil {
+			t.Fatalf("ParseMathML(%q) failed: %v", want, err)
+		}
+		if got, err := MathML(parsed); err != nil || got != want {
+			t.Errorf("round trip of %q = %s, %v; want %s", inp, got, err, want)
+		}
+	}
+}
@@ -0,0 +1,257 @@
+package eqdraw
+
+import (
+	"image"
+
+	"golang.org/x/image/math/fixed"
+)
+
+// Alignment describes how the cells of a column are aligned horizontally.
+type Alignment uint8
+
+// Valid Alignment values.
+const (
+	AlignCenter Alignment = iota
+	AlignLeft
+	AlignRight
+)
+
+// Delimiter describes the delimiters drawn around a Matrix.
+type Delimiter uint8
+
+// Valid Delimiter values.
+const (
+	DelimNone       Delimiter = iota
+	DelimParens               // ( ), as in a matrix.
+	DelimBrackets             // [ ], as in a matrix.
+	DelimBraces               // { }
+	DelimBars                 // | |, as in a determinant.
+	DelimDoubleBars           // ‖ ‖, as in a norm.
+)
+
+// runes returns the opening and closing delimiters, or zero for DelimNone.
+func (d Delimiter) runes() (open, close rune) {
+	switch d {
+	case DelimParens:
+		return '(', ')'
+	case DelimBrackets:
+		return '[', ']'
+	case DelimBraces:
+		return '{', '}'
+	case DelimBars:
+		return '|', '|'
+	case DelimDoubleBars:
+		return '‖', '‖'
+	}
+	return 0, 0
+}
+
+// Default spacing of the cells of a matrix, in ems.
+const (
+	defaultRowGap    = 0.5
+	defaultColumnGap = 1
+)
+
+// matrixDelimGap is the gap between a delimiter and the cells of a matrix,
+// in 26.6 fractions of an em.
+const matrixDelimGap fixed.Int26_6 = 10 // ~0.15
+
+var (
+	matrixMargin = LayoutResult{
+		Height: fixed.Int26_6(4 << 6),
+		Width:  fixed.Int26_6(2 << 6),
+	}
+)
+
+// Matrix represents a grid of cells, such as a matrix, determinant or
+// column vector. The grid is centered vertically on the math axis, and the
+// delimiters are stretched to its height.
+type Matrix struct {
+	// Rows holds the cells of each row. Rows may have differing numbers of
+	// cells, and cells may be nil.
+	Rows [][]Node
+	// Align holds the alignment of each column. Columns without an
+	// alignment are centered.
+	Align []Alignment
+	// RowGap and ColumnGap are the space between rows and columns, in
+	// ems. If zero, a default is used.
+	RowGap, ColumnGap float64
+	// Delims are the delimiters drawn around the grid.
+	Delims Delimiter
+}
+
+// matrixLayout describes the placement of the parts of a Matrix, as
+// computed by its layout pass. Positions are relative to the top left of
+// the node.
+type matrixLayout struct {
+	ff *Face
+	// cells holds the top left of each cell.
+	cells [][]fixed.Point26_6
+	// open and close are the origins of the delimiter glyphs.
+	open, close fixed.Point26_6
+}
+
+// columns returns the number of columns in the matrix.
+func (m *Matrix) columns() int {
+	n := 0
+	for _, row := range m.Rows {
+		if len(row) > n {
+			n = len(row)
+		}
+	}
+	return n
+}
+
+// align returns the alignment of column i.
+func (m *Matrix) align(i int) Alignment {
+	if i < len(m.Align) {
+		return m.Align[i]
+	}
+	return AlignCenter
+}
+
+// gaps returns the space between rows and columns.
+func (m *Matrix) gaps(dc *DrawContext) (row, col fixed.Int26_6) {
+	rg, cg := m.RowGap, m.ColumnGap
+	if rg == 0 {
+		rg = defaultRowGap
+	}
+	if cg == 0 {
+		cg = defaultColumnGap
+	}
+	em := float64(dc.em())
+	return fixed.Int26_6(rg * em), fixed.Int26_6(cg * em)
+}
+
+// Layout is called during the layout pass to compute the rendered size of this node.
+func (m *Matrix) Layout(dc *DrawContext) (*LayoutResult, error) {
+	// Size each column to its widest cell, and each row to its tallest.
+	var (
+		colWidth   = make([]fixed.Int26_6, m.columns())
+		rowAscent  = make([]fixed.Int26_6, len(m.Rows))
+		rowDescent = make([]fixed.Int26_6, len(m.Rows))
+	)
+	for i, row := range m.Rows {
+		for j, c := range row {
+			if c == nil {
+				continue
+			}
+			b, err := dc.Layout(c)
+			if err != nil {
+				return nil, err
+			}
+			if b.Width > colWidth[j] {
+				colWidth[j] = b.Width
+			}
+			if b.Ascent > rowAscent[i] {
+				rowAscent[i] = b.Ascent
+			}
+			if d := b.Descent(); d > rowDescent[i] {
+				rowDescent[i] = d
+			}
+		}
+	}
+
+	// Place the cells, relative to the top left of the grid.
+	l := &matrixLayout{cells: make([][]fixed.Point26_6, len(m.Rows))}
+	rowGap, colGap := m.gaps(dc)
+	var width, height fixed.Int26_6
+	for j, w := range colWidth {
+		if j > 0 {
+			width += colGap
+		}
+		width += w
+	}
+	for i, row := range m.Rows {
+		if i > 0 {
+			height += rowGap
+		}
+		l.cells[i] = make([]fixed.Point26_6, len(row))
+		x := fixed.Int26_6(0)
+		for j, c := range row {
+			if c != nil {
+				b := dc.Bounds(c)
+				l.cells[i][j] = fixed.Point26_6{X: x, Y: height + rowAscent[i] - b.Ascent}
+				switch m.align(j) {
+				case AlignCenter:
+					l.cells[i][j].X += (colWidth[j] - b.Width) / 2
+				case AlignRight:
+					l.cells[i][j].X += colWidth[j] - b.Width
+				}
+			}
+			x += colWidth[j] + colGap
+		}
+		height += rowAscent[i] + rowDescent[i]
+	}
+
+	// Stretch the delimiters to the height of the grid, centered on it.
+	// Coordinates are relative to the top of the grid until the top of the
+	// node is known.
+	top, bottom := fixed.Int26_6(0), height
+	var left fixed.Int26_6
+	open, close := m.Delims.runes()
+	if open != 0 {
+		l.ff, _ = dc.stretchFace(height)
+		for i, r := range []rune{open, close} {
+			if dc.strict && l.ff.Font.Index(r) == 0 {
+				return nil, &MissingGlyphError{Rune: r, Pos: i, Term: string([]rune{open, close})}
+			}
+		}
+		gap := dc.em().Mul(matrixDelimGap)
+
+		ob, oadv, _ := l.ff.GlyphBounds(open)
+		l.open.Y = height/2 - (ob.Min.Y+ob.Max.Y)/2
+		if oy := l.open.Y + ob.Min.Y; oy < top {
+			top = oy
+		}
+		if oy := l.open.Y + ob.Max.Y; oy > bottom {
+			bottom = oy
+		}
+		left = oadv + gap
+
+		cb, cadv, _ := l.ff.GlyphBounds(close)
+		l.close = fixed.Point26_6{X: left + width + gap, Y: height/2 - (cb.Min.Y+cb.Max.Y)/2}
+		width += gap + cadv
+	}
+	width += left
+
+	// Make each position relative to the top left of the node.
+	for i := range l.cells {
+		for j := range l.cells[i] {
+			l.cells[i][j].X += left
+			l.cells[i][j].Y -= top
+		}
+	}
+	l.open.Y -= top
+	l.close.Y -= top
+	dc.states[m] = l
+
+	return &LayoutResult{
+		Width:  width + matrixMargin.Width,
+		Height: bottom - top + matrixMargin.Height,
+		Ascent: height/2 + dc.mathAxis() - top + matrixMargin.Height/2,
+	}, nil
+}
+
+// Draw is called to render the delimiters and cells of the matrix.
+func (m *Matrix) Draw(dc *DrawContext, pos fixed.Point26_6, clip image.Rectangle) error {
+	l := dc.states[m].(*matrixLayout)
+	pos.X += matrixMargin.Width / 2
+	pos.Y += matrixMargin.Height / 2
+
+	if open, close := m.Delims.runes(); open != 0 {
+		dc.c.Glyph(l.ff, pos.Add(l.open), open, dc.fg.C, clip)
+		dc.c.Glyph(l.ff, pos.Add(l.close), close, dc.fg.C, clip)
+	}
+	for i, row := range m.Rows {
+		for j, c := range row {
+			if c == nil {
+				continue
+			}
+			if err := c.Draw(dc, pos.Add(l.cells[i][j]), clip); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,139 @@
+package eqdraw
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// ErrorKind classifies the problem described by a ParseError.
+type ErrorKind uint8
+
+// Valid ErrorKind values.
+const (
+	// KindUnexpected is input which cannot appear where it does.
+	KindUnexpected ErrorKind = iota
+	// KindUnmatched is a group or quote which is not closed, or a closing
+	// token which was not opened.
+	KindUnmatched
+	// KindMissingOperand is an operator, command or element missing an
+	// operand or argument.
+	KindMissingOperand
+	// KindUnsupported is valid syntax which is not supported, such as an
+	// unknown LaTeX command.
+	KindUnsupported
+)
+
+func (k ErrorKind) String() string {
+	switch k {
+	case KindUnexpected:
+		return "unexpected"
+	case KindUnmatched:
+		return "unmatched"
+	case KindMissingOperand:
+		return "missing operand"
+	case KindUnsupported:
+		return "unsupported"
+	}
+	return fmt.Sprintf("ErrorKind(%d)", k)
+}
+
+// ParseError describes a problem with the input to one of the parsers.
+type ParseError struct {
+	// Pos is the position in the input the problem occurred, counted in
+	// runes and starting from 1. For input on a single line, this is the
+	// column of the problem.
+	Pos int
+	// Offset is the position of the problem in bytes, starting from 0.
+	Offset int
+	// Line and Column are the line of the input the problem occurred on,
+	// and its position within that line in runes, both starting from 1.
+	Line, Column int
+	// Len is the length of the input at fault, in runes. It is zero for
+	// problems at the end of the input.
+	Len  int
+	Kind ErrorKind
+	Msg  string
+}
+
+func (e *ParseError) Error() string {
+	if e.Line == 0 {
+		return fmt.Sprintf("%s at position %d", e.Msg, e.Pos)
+	}
+	return fmt.Sprintf("%s at line %d, column %d", e.Msg, e.Line, e.Column)
+}
+
+// locate sets the line and column of e from its offset into input.
+func (e *ParseError) locate(input string) {
+	off := e.Offset
+	if off > len(input) {
+		off = len(input)
+	}
+	start := strings.LastIndexByte(input[:off], '\n') + 1
+	e.Line = strings.Count(input[:start], "\n") + 1
+	e.Column = utf8.RuneCountInString(input[start:off]) + 1
+}
+
+// locateError sets the line and column of err, if it is a *ParseError,
+// returning err.
+func locateError(err error, input string) error {
+	if pe, ok := err.(*ParseError); ok {
+		pe.locate(input)
+	}
+	return err
+}
+
+// Snippet returns the line of input containing the problem, followed by a
+// line underlining the input at fault, such as:
+//
+//	2(1 + 2
+//	 ^
+//
+// The input must be the input given to the parser which returned e.
+func (e *ParseError) Snippet(input string) string {
+	off := e.Offset
+	if off > len(input) {
+		off = len(input)
+	}
+	start := strings.LastIndexByte(input[:off], '\n') + 1
+	end := strings.IndexByte(input[off:], '\n')
+	if end < 0 {
+		end = len(input)
+	} else {
+		end += off
+	}
+
+	var b strings.Builder
+	b.WriteString(input[start:end])
+	b.WriteByte('\n')
+	// Tabs are kept so the underline lines up however they are displayed.
+	for _, c := range input[start:off] {
+		if c == '\t' {
+			b.WriteByte('\t')
+		} else {
+			b.WriteByte(' ')
+		}
+	}
+	n := e.Len
+	if rest := utf8.RuneCountInString(input[off:end]); n > rest {
+		n = rest
+	}
+	b.WriteByte('^')
+	if n > 1 {
+		b.WriteString(strings.Repeat("~", n-1))
+	}
+	return b.String()
+}
+
+// MissingGlyphError is returned when laying out a term in strict mode, if
+// a rune cannot be drawn by any font.
+type MissingGlyphError struct {
+	Rune rune
+	// Pos is the index of the rune within the content of the term.
+	Pos  int
+	Term string
+}
+
+func (e *MissingGlyphError) Error() string {
+	return fmt.Sprintf("no font has a glyph for %q (%U) at position %d of term %q", e.Rune, e.Rune, e.Pos, e.Term)
+}
@@ -0,0 +1,78 @@
+package eqdraw
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseErrorSnippet(t *testing.T) {
+	tcs := []struct {
+		name     string
+		input    string
+		parse    func(string) (Node, error)
+		expected string
+	}{
+		{
+			name:     "unmatched",
+			input:    "2(1 + 2",
+			parse:    ParseASCIIEquation,
+			expected: "2(1 + 2\n ^",
+		},
+		{
+			name:     "span",
+			input:    "π = sqrt(x",
+			parse:    ParseASCIIEquation,
+			expected: "π = sqrt(x\n    ^~~~~",
+		},
+		{
+			name:     "end of input",
+			input:    "1 +",
+			parse:    ParseASCIIEquation,
+			expected: "1 +\n  ^",
+		},
+		{
+			name:     "latex command",
+			input:    `1 + \foo{2}`,
+			parse:    ParseLaTeX,
+			expected: "1 + \\foo{2}\n    ^~~~",
+		},
+		{
+			name:     "second line",
+			input:    "<math>\n\t<menclose></menclose></math>",
+			parse:    func(s string) (Node, error) { return ParseMathML(strings.NewReader(s)) },
+			expected: "\t<menclose></menclose></math>\n\t^~~~~~~~~~",
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := tc.parse(tc.input)
+			pe, ok := err.(*ParseError)
+			if !ok {
+				t.Fatalf("parse error = %v, want *ParseError", err)
+			}
+			if got := pe.Snippet(tc.input); got != tc.expected {
+				t.Errorf("Snippet() = %q, want %q", got, tc.expected)
+			}
+		})
+	}
+}
+
+func TestParseErrorLocation(t *testing.T) {
+	_, err := ParseASCIIEquation("x = 1 +\n  ∛(2")
+	pe, ok := err.(*ParseError)
+	if !ok {
+		t.Fatalf("parse error = %v, want *ParseError", err)
+	}
+	if pe.Line != 2 || pe.Column != 4 {
+		t.Errorf("location = line %d, column %d; want line 2, column 4", pe.Line, pe.Column)
+	}
+	if want := "unmatched start parenthesis at line 2, column 4"; pe.Error() != want {
+		t.Errorf("Error() = %q, want %q", pe.Error(), want)
+	}
+
+	_, diags := ParseASCIIEquationTolerant("1 + 2\n)")
+	if len(diags) != 1 || diags[0].Line != 2 || diags[0].Column != 1 {
+		t.Errorf("diagnostics = %v, want one at line 2, column 1", diags)
+	}
+}
@@ -0,0 +1,88 @@
+package eqdraw
+
+import (
+	"image"
+	"image/color"
+
+	"github.com/golang/freetype/truetype"
+	"golang.org/x/image/math/fixed"
+)
+
+// RecordedOpKind describes the kind of a RecordedOp.
+type RecordedOpKind uint8
+
+// Valid RecordedOpKind values.
+const (
+	RecordedGlyph RecordedOpKind = iota
+	RecordedRect
+	RecordedPath
+)
+
+// RecordedOp is a drawing operation captured by a Recorder.
+type RecordedOp struct {
+	Kind  RecordedOpKind
+	Color color.Color
+
+	// Rune, Dot, Size and Font describe a drawn glyph.
+	Rune rune
+	Dot  fixed.Point26_6
+	Size float64
+	Font *truetype.Font
+	// Rect is the rectangle drawn by a RecordedRect operation.
+	Rect image.Rectangle
+	// Path is the path drawn by a RecordedPath operation, and Clip the
+	// rectangle it is clipped to. The path may extend beyond Clip.
+	Path Path
+	Clip image.Rectangle
+}
+
+// Recorder is a Canvas which records the operations drawn onto it, rather
+// than producing any output. It is useful for testing the drawing of
+// nodes.
+type Recorder struct {
+	Ops []RecordedOp
+}
+
+// Glyph implements Canvas.
+func (r *Recorder) Glyph(f *Face, dot fixed.Point26_6, c rune, col color.Color, clip image.Rectangle) (fixed.Int26_6, bool) {
+	advance, ok := f.GlyphAdvance(c)
+	if !ok {
+		return 0, false
+	}
+	r.Ops = append(r.Ops, RecordedOp{
+		Kind:  RecordedGlyph,
+		Color: col,
+		Rune:  c,
+		Dot:   dot,
+		Size:  f.Options.Size,
+		Font:  f.Font,
+	})
+	return advance, true
+}
+
+// FillRect implements Canvas. Rectangles are recorded clipped, and not at
+// all if they lie outside the clip rectangle.
+func (r *Recorder) FillRect(rect image.Rectangle, c color.Color, clip image.Rectangle) {
+	if rect = rect.Intersect(clip); rect.Empty() {
+		return
+	}
+	r.Ops = append(r.Ops, RecordedOp{
+		Kind:  RecordedRect,
+		Color: c,
+		Rect:  rect,
+	})
+}
+
+// FillPath implements Canvas. Paths are recorded with their clip
+// rectangle, and not at all if they lie outside it.
+func (r *Recorder) FillPath(p Path, c color.Color, clip image.Rectangle) {
+	if !p.bounds().Overlaps(clip) {
+		return
+	}
+	r.Ops = append(r.Ops, RecordedOp{
+		Kind:  RecordedPath,
+		Color: c,
+		Path:  append(Path{}, p...),
+		Clip:  clip,
+	})
+}
@@ -3,11 +3,8 @@ package eqdraw
 import (
 	"image"
 	"image/color"
-	"image/draw"
 	"math"
 
-	"github.com/golang/freetype/truetype"
-	"golang.org/x/image/font"
 	"golang.org/x/image/math/fixed"
 )
 
@@ -18,11 +15,11 @@ const (
 )
 
 var (
-	rootMargin = layoutResult{
+	rootMargin = LayoutResult{
 		Height: fixed.Int26_6(0 << 6),
 		Width:  fixed.Int26_6(2 << 6),
 	}
-	rootPadding = layoutResult{
+	rootPadding = LayoutResult{
 		Height: fixed.Int26_6(2 << 6),
 		Width:  fixed.Int26_6(0 << 6),
 	}
@@ -30,116 +27,159 @@ var (
 
 // Root represents a term within a surd.
 type Root struct {
-	ff          font.Face
-	layout      *layoutResult
-	numMacrons  int
-	macronWidth fixed.Int26_6
-
-	Term node
+	Term Node
+	// Index is the degree of the root, such as 3 for a cube root, drawn at
+	// script size in the crook of the surd. If nil, the root is a square
+	// root.
+	Index Node
 }
 
-// Bounds returns the width and height of the rendered term, as computed by
-// the last layout pass. If no layout pass has occurred, the returned value
-// will be nil.
-func (p *Root) Bounds() *layoutResult {
-	return p.layout
+// rootLayout describes the symbols drawn by a Root, as computed by its
+// layout pass.
+type rootLayout struct {
+	ff          *Face
+	numMacrons  int
+	macronWidth fixed.Int26_6
+	// index is the top left of the index, and offset is how far the surd
+	// and term are moved to make room for it.
+	index, offset fixed.Point26_6
 }
 
 // Layout is called during the layout pass to compute the rendered size of this node.
-func (p *Root) Layout(dc *DrawContext) error {
-	sz := layoutResult{}
+func (p *Root) Layout(dc *DrawContext) (*LayoutResult, error) {
+	sz := LayoutResult{}
 	if p.Term != nil {
-		if err := p.Term.Layout(dc); err != nil {
-			return err
+		b, err := dc.Layout(p.Term)
+		if err != nil {
+			return nil, err
 		}
-		b := p.Term.Bounds()
 		sz.Width += b.Width + rootPadding.Width
 		sz.Height += b.Height + rootPadding.Height
+		sz.Ascent = b.Ascent + rootPadding.Height + rootMargin.Height/2
 	}
 
 	// Determine the appropriate font size so the surd is taller than the term.
-	for fz := dc.o.Size; fz < 144; fz++ {
-		opts := dc.o
-		opts.Size = fz
-		p.ff = truetype.NewFace(dc.f, &opts)
-		if h := p.ff.Metrics().Height; h >= sz.Height {
-			sz.Height = h
-			break
-		}
+	var (
+		l  rootLayout
+		ok bool
+	)
+	if l.ff, ok = dc.stretchFace(sz.Height); ok {
+		sz.Height = l.ff.Metrics().Height
+	}
+
+	if p.Term == nil {
+		sz.Ascent = l.ff.Metrics().Ascent + rootMargin.Height/2
 	}
 
 	// Determine how many macron characters are needed for the top bar.
-	mw, _, _ := p.ff.GlyphBounds(macronChar)
-	p.numMacrons = int(math.Ceil(float64(sz.Width.Ceil()) / float64((mw.Max.X - mw.Min.X).Ceil())))
-	p.macronWidth = fixed.Int26_6(p.numMacrons) * (mw.Max.X - mw.Min.X)
+	mw, _, _ := l.ff.GlyphBounds(macronChar)
+	l.numMacrons = int(math.Ceil(float64(sz.Width.Ceil()) / float64((mw.Max.X - mw.Min.X).Ceil())))
+	l.macronWidth = fixed.Int26_6(l.numMacrons) * (mw.Max.X - mw.Min.X)
 	// If the macrons are slightly larger, update the width.
-	if p.macronWidth > sz.Width {
-		sz.Width = p.macronWidth
+	if l.macronWidth > sz.Width {
+		sz.Width = l.macronWidth
 	}
 
 	// Add the widths for the surd.
-	a, _ := p.ff.GlyphAdvance(surdChar)
+	a, _ := l.ff.GlyphAdvance(surdChar)
 	sz.Width += a
 
+	if p.Index != nil {
+		ib, err := dc.scriptContext().Layout(p.Index)
+		if err != nil {
+			return nil, err
+		}
+		// Place the index in the crook, moving the surd right if the index
+		// is wider than it, and down if the index is taller.
+		c := l.computeIndexPosition()
+		l.index = fixed.Point26_6{X: c.X - ib.Width, Y: l.ff.Metrics().Ascent + c.Y - ib.Height}
+		if l.index.X < 0 {
+			l.offset.X = -l.index.X
+		}
+		if l.index.Y < 0 {
+			l.offset.Y = -l.index.Y
+		}
+		l.index = l.index.Add(l.offset)
+		sz.Width += l.offset.X
+		sz.Height += l.offset.Y
+		sz.Ascent += l.offset.Y
+	}
+
 	sz.Height += rootMargin.Height
 	sz.Width += rootMargin.Width
-	p.layout = &sz
-	return nil
+	dc.states[p] = &l
+	return &sz, nil
+}
+
+// computeIndexPosition returns the bottom right corner of the index,
+// relative to the origin of the surd glyph. The index sits over the short
+// stroke on the left of the surd, its bottom a little above the middle of
+// the glyph.
+func (l *rootLayout) computeIndexPosition() fixed.Point26_6 {
+	sb, _, _ := l.ff.GlyphBounds(surdChar)
+	return fixed.Point26_6{
+		X: sb.Min.X + (sb.Max.X-sb.Min.X)/2,
+		Y: sb.Max.Y - (sb.Max.Y-sb.Min.Y)*3/5,
+	}
 }
 
 // computeYAdjustment returns the vertical distance the macron needs to be moved,
 // to line up with the surd glyph.
-func (p *Root) computeYAdjustment() fixed.Int26_6 {
-	sb, _, _ := p.ff.GlyphBounds(surdChar)
-	mb, _, _ := p.ff.GlyphBounds(macronChar)
+func (l *rootLayout) computeYAdjustment() fixed.Int26_6 {
+	sb, _, _ := l.ff.GlyphBounds(surdChar)
+	mb, _, _ := l.ff.GlyphBounds(macronChar)
 	return sb.Min.Y - mb.Min.Y - (mb.Max.Y-mb.Min.Y)/3
 }
 
 // Draw is called to render the parentheses and its contained terms.
 func (p *Root) Draw(dc *DrawContext, pos fixed.Point26_6, clip image.Rectangle) error {
-	m := p.ff.Metrics()
+	l := dc.states[p].(*rootLayout)
+	m := l.ff.Metrics()
 	pos.X += rootMargin.Width / 2
 	pos.Y += rootMargin.Height / 2
 
+	if p.Index != nil {
+		script := dc.scriptContext()
+		script.c, script.fg = dc.c, dc.fg
+		if err := p.Index.Draw(script, pos.Add(l.index), clip); err != nil {
+			return err
+		}
+		pos = pos.Add(l.offset)
+	}
+
 	if rootDebug {
 		// baseline (red).
-		for i := 0; i < 22; i++ {
-			dc.out.Set(pos.X.Floor()+i, (pos.Y + m.Ascent - m.Descent).Round(), color.RGBA{255, 0, 0, 255})
-		}
+		dc.c.FillRect(image.Rect(pos.X.Floor(), (pos.Y+m.Ascent-m.Descent).Round(), pos.X.Floor()+22, (pos.Y+m.Ascent-m.Descent).Round()+1), color.RGBA{255, 0, 0, 255}, clip)
 		// ascent (blue).
-		for i := 0; i < 22; i++ {
-			dc.out.Set(pos.X.Floor()+i, (pos.Y + m.Descent).Round(), color.RGBA{0, 0, 255, 255})
-		}
+		dc.c.FillRect(image.Rect(pos.X.Floor(), (pos.Y+m.Descent).Round(), pos.X.Floor()+22, (pos.Y+m.Descent).Round()+1), color.RGBA{0, 0, 255, 255}, clip)
 		// descent (green).
-		for i := 0; i < 22; i++ {
-			dc.out.Set(pos.X.Floor()+i, (pos.Y + m.Ascent).Round(), color.RGBA{0, 255, 0, 255})
-		}
+		dc.c.FillRect(image.Rect(pos.X.Floor(), (pos.Y+m.Ascent).Round(), pos.X.Floor()+22, (pos.Y+m.Ascent).Round()+1), color.RGBA{0, 255, 0, 255}, clip)
 	}
 
 	pos.Y += m.Ascent
-	dr, mask, maskp, advance, _ := p.ff.Glyph(pos, surdChar)
 	if rootDebug {
-		draw.DrawMask(dc.out, dr.Intersect(clip), dc.fg, image.Point{}, image.NewUniform(color.RGBA{A: 120}), maskp, draw.Over)
+		if b, _, ok := l.ff.GlyphBounds(surdChar); ok {
+			dc.c.FillRect(glyphRect(b, pos), color.RGBA{A: 120}, clip)
+		}
 	}
-	draw.DrawMask(dc.out, dr.Intersect(clip), dc.fg, image.Point{}, mask, maskp, draw.Over)
+	advance, _ := dc.c.Glyph(l.ff, pos, surdChar, dc.fg.C, clip)
 
 	pos.X += advance
 	p2 := pos
-	p2.Y += p.computeYAdjustment()
+	p2.Y += l.computeYAdjustment()
 	p2.X -= 32
-	for x := 0; x < p.numMacrons; x++ {
-		dr, mask, maskp, advance, _ := p.ff.Glyph(p2, macronChar)
-		draw.DrawMask(dc.out, dr.Intersect(clip), dc.fg, image.Point{}, mask, maskp, draw.Over)
+	for x := 0; x < l.numMacrons; x++ {
+		advance, _ := dc.c.Glyph(l.ff, p2, macronChar, dc.fg.C, clip)
 		p2.X += advance
 	}
 
-	pos.X += (p.macronWidth - p.Term.Bounds().Width) / 3
-	pos.Y += rootPadding.Height - m.Ascent
 	if p.Term != nil {
+		pos.X += (l.macronWidth - dc.Bounds(p.Term).Width) / 3
+		pos.Y += rootPadding.Height - m.Ascent
 		if err := p.Term.Draw(dc, pos, clip); err != nil {
 			return err
 		}
-		pos.X += p.Term.Bounds().Width
+		pos.X += dc.Bounds(p.Term).Width
 		pos.Y += m.Ascent
 	}
 	return nil
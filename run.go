@@ -7,7 +7,7 @@ import (
 )
 
 var (
-	runMargin = layoutResult{
+	runMargin = LayoutResult{
 		Height: fixed.Int26_6(2 << 6),
 		Width:  fixed.Int26_6(4 << 6),
 	}
@@ -15,49 +15,42 @@ var (
 
 // Run represents a horizontal series of terms.
 type Run struct {
-	layout      *layoutResult
-	tallestTerm fixed.Int26_6
-
-	Terms []node
-}
-
-// Bounds returns the width and height of the rendered term, as computed by
-// the last layout pass. If no layout pass has occurred, the returned value
-// will be nil.
-func (r *Run) Bounds() *layoutResult {
-	return r.layout
+	Terms []Node
 }
 
 // Layout is called during the layout pass to compute the rendered size of this node.
-func (r *Run) Layout(dc *DrawContext) error {
+func (r *Run) Layout(dc *DrawContext) (*LayoutResult, error) {
 	sz := runMargin
 
-	var tallestTerm fixed.Int26_6
+	var ascent, descent fixed.Int26_6
 	for _, t := range r.Terms {
-		if err := t.Layout(dc); err != nil {
-			return err
+		b, err := dc.Layout(t)
+		if err != nil {
+			return nil, err
 		}
-		b := t.Bounds()
 		sz.Width += b.Width
-		if b.Height > tallestTerm {
-			tallestTerm = b.Height
+		if b.Ascent > ascent {
+			ascent = b.Ascent
+		}
+		if d := b.Descent(); d > descent {
+			descent = d
 		}
 	}
-	r.tallestTerm = tallestTerm
 
-	sz.Height += r.tallestTerm
-	r.layout = &sz
-	return nil
+	sz.Ascent = runMargin.Height/2 + ascent
+	sz.Height += ascent + descent
+	return &sz, nil
 }
 
 // Draw is called to render the series of terms.
 func (r *Run) Draw(dc *DrawContext, pos fixed.Point26_6, clip image.Rectangle) error {
 	pos.X += runMargin.Width / 2
-	pos.Y += runMargin.Height / 2
 
+	// Align the baselines of all terms.
+	ascent := dc.Bounds(r).Ascent
 	for _, t := range r.Terms {
-		sz := t.Bounds()
-		adjustY := (r.tallestTerm - sz.Height) / 2
+		sz := dc.Bounds(t)
+		adjustY := ascent - sz.Ascent
 		pos.Y += adjustY
 		if err := t.Draw(dc, pos, clip); err != nil {
 			return err
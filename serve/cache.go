@@ -0,0 +1,100 @@
+package serve
+
+import (
+	"container/list"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// memCache is a least-recently-used cache of rendered images, bounded by
+// the total size of the images it holds.
+type memCache struct {
+	mu       sync.Mutex
+	maxBytes int64
+	size     int64
+	order    *list.List // Of *memEntry, most recently used first.
+	entries  map[string]*list.Element
+}
+
+type memEntry struct {
+	key  string
+	data []byte
+}
+
+func newMemCache(maxBytes int64) *memCache {
+	return &memCache{
+		maxBytes: maxBytes,
+		order:    list.New(),
+		entries:  map[string]*list.Element{},
+	}
+}
+
+func (c *memCache) get(key string) ([]byte, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	c.order.MoveToFront(e)
+	return e.Value.(*memEntry).data, true
+}
+
+func (c *memCache) put(key string, data []byte) {
+	if int64(len(data)) > c.maxBytes {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.entries[key]; ok {
+		return
+	}
+
+	c.entries[key] = c.order.PushFront(&memEntry{key: key, data: data})
+	c.size += int64(len(data))
+	for c.size > c.maxBytes {
+		e := c.order.Remove(c.order.Back()).(*memEntry)
+		delete(c.entries, e.key)
+		c.size -= int64(len(e.data))
+	}
+}
+
+// diskCache stores rendered images as files within a directory, named by
+// their key.
+type diskCache struct {
+	dir string
+}
+
+func (c *diskCache) path(key string) string {
+	return filepath.Join(c.dir, key[:2], key)
+}
+
+func (c *diskCache) get(key string) ([]byte, bool) {
+	data, err := ioutil.ReadFile(c.path(key))
+	return data, err == nil
+}
+
+// put writes an image to the cache. The image is written to a temporary
+// file first, so concurrent readers never see a partial image.
+func (c *diskCache) put(key string, data []byte) error {
+	p := c.path(key)
+	if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+		return err
+	}
+	f, err := ioutil.TempFile(filepath.Dir(p), key+".tmp")
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	return os.Rename(f.Name(), p)
+}
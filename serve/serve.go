@@ -0,0 +1,399 @@
+// Package serve implements an HTTP service which renders equations.
+//
+// Equations are rendered by requesting /render.png or /render.svg, with the
+// equation in the eq query parameter, for example:
+//
+//	/render.png?eq=x^2+%2B+1&size=24&fg=%23333&bg=white&padding=4
+//
+// The size, fg, bg and padding parameters are optional. Sizes are rounded to
+// the nearest half point, so requests for nearly equal sizes share font
+// faces and cached images. Equations which are nested too deeply, or whose
+// images would be too large, are rejected. Rendered images are cached in
+// memory, and optionally on disk, keyed by a hash of the equation and the
+// render options. Invalid requests are answered with a JSON object
+// describing the problem.
+package serve
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/golang/freetype/truetype"
+	"github.com/twitchyliquid64/eqdraw"
+)
+
+// Default limits, used when the corresponding Options field is zero.
+const (
+	DefaultMaxSize           = 256
+	DefaultMaxEquationLength = 2048
+	DefaultMaxPixels         = 8 << 20
+	DefaultMaxDepth          = 32
+	DefaultMemoryCacheBytes  = 64 << 20
+)
+
+const (
+	defaultSize = 24
+	maxPadding  = 100
+)
+
+// formats maps each endpoint to the content type of the image it serves.
+var formats = map[string]string{
+	"/render.png": "image/png",
+	"/render.svg": "image/svg+xml",
+}
+
+// Options configures a Handler.
+type Options struct {
+	// Fonts are the fonts equations are drawn with. If nil, the default
+	// font set is used.
+	Fonts *eqdraw.FontSet
+	// CacheDir is the directory rendered images are cached in. If empty,
+	// images are only cached in memory. The directory should be emptied
+	// if the fonts are changed.
+	CacheDir string
+	// MemoryCacheBytes bounds the total size of the images cached in
+	// memory. If negative, images are not cached in memory.
+	MemoryCacheBytes int64
+	// MaxSize is the largest font size which may be requested.
+	MaxSize float64
+	// MaxEquationLength is the length in bytes of the longest equation
+	// which may be requested.
+	MaxEquationLength int
+	// MaxPixels bounds the area, in pixels, of a rendered image. Requests
+	// for larger images are rejected before they are drawn.
+	MaxPixels int64
+	// MaxDepth bounds how deeply the parts of an equation, such as
+	// parentheses and fractions, may be nested.
+	MaxDepth int
+}
+
+// Handler is a http.Handler which renders equations.
+type Handler struct {
+	renderer *eqdraw.Renderer
+	opts     Options
+	mem      *memCache
+	disk     *diskCache
+}
+
+// New creates a new Handler.
+func New(opts Options) (*Handler, error) {
+	r, err := eqdraw.NewRenderer(truetype.Options{Size: defaultSize}, opts.Fonts)
+	if err != nil {
+		return nil, err
+	}
+	if opts.MaxSize == 0 {
+		opts.MaxSize = DefaultMaxSize
+	}
+	if opts.MaxEquationLength == 0 {
+		opts.MaxEquationLength = DefaultMaxEquationLength
+	}
+	if opts.MaxPixels == 0 {
+		opts.MaxPixels = DefaultMaxPixels
+	}
+	if opts.MaxDepth == 0 {
+		opts.MaxDepth = DefaultMaxDepth
+	}
+	if opts.MemoryCacheBytes == 0 {
+		opts.MemoryCacheBytes = DefaultMemoryCacheBytes
+	}
+
+	h := &Handler{renderer: r, opts: opts}
+	if opts.MemoryCacheBytes > 0 {
+		h.mem = newMemCache(opts.MemoryCacheBytes)
+	}
+	if opts.CacheDir != "" {
+		h.disk = &diskCache{dir: opts.CacheDir}
+	}
+	return h, nil
+}
+
+// Error is the body of a response to a request which could not be
+// rendered.
+type Error struct {
+	// Kind is one of "request", for invalid query parameters, "parse", for
+	// an equation which could not be parsed, or "render".
+	Kind    string `json:"kind"`
+	Message string `json:"error"`
+	// Position is the position of a parse error in the equation, counted
+	// in runes and starting from 1.
+	Position int `json:"position,omitempty"`
+	// Length is the length in runes of the input at fault in a parse
+	// error.
+	Length int `json:"length,omitempty"`
+}
+
+func writeError(w http.ResponseWriter, code int, e Error) {
+	w.Header().Del("ETag")
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(e)
+}
+
+// request holds the parsed parameters of a render request.
+type request struct {
+	path    string
+	eq      string
+	size    float64
+	fg, bg  color.RGBA
+	padding int
+}
+
+// key returns a hash identifying the image the request renders.
+func (req *request) key() string {
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\x00%s\x00%g\x00%v\x00%v\x00%d", req.path, req.eq, req.size, req.fg, req.bg, req.padding)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func (h *Handler) parseRequest(r *http.Request) (*request, error) {
+	q := r.URL.Query()
+	req := &request{
+		path: r.URL.Path,
+		eq:   q.Get("eq"),
+		size: defaultSize,
+		fg:   color.RGBA{A: 0xff},
+	}
+
+	switch {
+	case strings.TrimSpace(req.eq) == "":
+		return nil, errors.New("missing eq parameter")
+	case len(req.eq) > h.opts.MaxEquationLength:
+		return nil, fmt.Errorf("equation longer than %d bytes", h.opts.MaxEquationLength)
+	}
+
+	if s := q.Get("size"); s != "" {
+		v, err := strconv.ParseFloat(s, 64)
+		if err != nil || v < 1 || v > h.opts.MaxSize {
+			return nil, fmt.Errorf("size must be a number between 1 and %g", h.opts.MaxSize)
+		}
+		req.size = math.Round(v*2) / 2
+	}
+	if s := q.Get("padding"); s != "" {
+		v, err := strconv.Atoi(s)
+		if err != nil || v < 0 || v > maxPadding {
+			return nil, fmt.Errorf("padding must be an integer between 0 and %d", maxPadding)
+		}
+		req.padding = v
+	}
+	for _, c := range []struct {
+		name string
+		out  *color.RGBA
+	}{{"fg", &req.fg}, {"bg", &req.bg}} {
+		if s := q.Get(c.name); s != "" {
+			v, err := eqdraw.ParseColor(s)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %v", c.name, err)
+			}
+			*c.out = color.RGBAModel.Convert(v).(color.RGBA)
+		}
+	}
+	return req, nil
+}
+
+// limitError is returned by render for an equation exceeding the limits
+// of the handler.
+type limitError string
+
+func (e limitError) Error() string {
+	return string(e)
+}
+
+// depth returns how deeply the parts of the node tree n are nested. Runs
+// do not add to the depth of their terms.
+func depth(n eqdraw.Node) int {
+	var children []eqdraw.Node
+	switch n := n.(type) {
+	case nil:
+		return 0
+	case *eqdraw.Run:
+		max := 0
+		for _, t := range n.Terms {
+			if d := depth(t); d > max {
+				max = d
+			}
+		}
+		return max
+	case *eqdraw.Div:
+		children = []eqdraw.Node{n.Numerator, n.Denominator}
+	case *eqdraw.Root:
+		children = []eqdraw.Node{n.Term, n.Index}
+	case *eqdraw.Parenthesis:
+		children = []eqdraw.Node{n.Term}
+	case *eqdraw.Sup:
+		children = []eqdraw.Node{n.Base, n.Exponent}
+	case *eqdraw.Sub:
+		children = []eqdraw.Node{n.Base, n.Index, n.Exponent}
+	case *eqdraw.BigOp:
+		children = []eqdraw.Node{n.Lower, n.Upper, n.Body}
+	case *eqdraw.Matrix:
+		for _, row := range n.Rows {
+			children = append(children, row...)
+		}
+	}
+	max := 0
+	for _, c := range children {
+		if d := depth(c); d > max {
+			max = d
+		}
+	}
+	return max + 1
+}
+
+// render draws the equation described by req, encoded in the format of
+// its endpoint. A limitError is returned if the equation is nested too
+// deeply, or its image would be too large.
+func (h *Handler) render(req *request, n eqdraw.Node) ([]byte, error) {
+	if depth(n) > h.opts.MaxDepth {
+		return nil, limitError(fmt.Sprintf("equation nested more than %d levels deep", h.opts.MaxDepth))
+	}
+	r := h.renderer.WithSize(req.size).WithPadding(req.padding)
+	b, err := r.Measure(n)
+	if err != nil {
+		return nil, err
+	}
+	if int64(b.Dx())*int64(b.Dy()) > h.opts.MaxPixels {
+		return nil, limitError(fmt.Sprintf("image larger than %d pixels", h.opts.MaxPixels))
+	}
+	fg := image.NewUniform(req.fg)
+	var bg *image.Uniform
+	if req.bg.A != 0 {
+		bg = image.NewUniform(req.bg)
+	}
+
+	var buf bytes.Buffer
+	if req.path == "/render.svg" {
+		if err := r.DrawSVG(&buf, n, fg, bg); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	}
+	img, err := r.DrawRGBA(n, fg, bg)
+	if err != nil {
+		return nil, err
+	}
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// lookup returns the image for key from the caches, if present.
+func (h *Handler) lookup(key string) ([]byte, bool) {
+	if h.mem != nil {
+		if data, ok := h.mem.get(key); ok {
+			return data, true
+		}
+	}
+	if h.disk != nil {
+		if data, ok := h.disk.get(key); ok {
+			if h.mem != nil {
+				h.mem.put(key, data)
+			}
+			return data, true
+		}
+	}
+	return nil, false
+}
+
+// store adds a rendered image to the caches.
+func (h *Handler) store(key string, data []byte) {
+	if h.mem != nil {
+		h.mem.put(key, data)
+	}
+	if h.disk != nil {
+		if err := h.disk.put(key, data); err != nil {
+			log.Printf("serve: caching %s: %v", key, err)
+		}
+	}
+}
+
+// etagMatches returns true if the If-None-Match header value match includes
+// etag.
+func etagMatches(match, etag string) bool {
+	for _, m := range strings.Split(match, ",") {
+		m = strings.TrimPrefix(strings.TrimSpace(m), "W/")
+		if m == etag || m == "*" {
+			return true
+		}
+	}
+	return false
+}
+
+// ServeHTTP implements http.Handler.
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	contentType, ok := formats[r.URL.Path]
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		writeError(w, http.StatusMethodNotAllowed, Error{Kind: "request", Message: "method not allowed"})
+		return
+	}
+
+	req, err := h.parseRequest(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, Error{Kind: "request", Message: err.Error()})
+		return
+	}
+	key := req.key()
+	etag := `"` + key + `"`
+
+	// Images are addressed by their content, so never change.
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+	if etagMatches(r.Header.Get("If-None-Match"), etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	data, ok := h.lookup(key)
+	if !ok {
+		n, err := eqdraw.ParseASCIIEquation(req.eq)
+		if err != nil {
+			e := Error{Kind: "parse", Message: err.Error()}
+			var pe *eqdraw.ParseError
+			if errors.As(err, &pe) {
+				e.Message, e.Position, e.Length = pe.Msg, pe.Pos, pe.Len
+			}
+			writeError(w, http.StatusBadRequest, e)
+			return
+		}
+		if n == nil {
+			// The equation held only separators, such as commas.
+			writeError(w, http.StatusBadRequest, Error{Kind: "request", Message: "missing eq parameter"})
+			return
+		}
+		if data, err = h.render(req, n); err != nil {
+			var le limitError
+			if errors.As(err, &le) {
+				writeError(w, http.StatusBadRequest, Error{Kind: "request", Message: err.Error()})
+				return
+			}
+			writeError(w, http.StatusInternalServerError, Error{Kind: "render", Message: err.Error()})
+			return
+		}
+		h.store(key, data)
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+	if r.Method == http.MethodHead {
+		return
+	}
+	w.Write(data)
+}
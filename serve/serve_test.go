@@ -0,0 +1,179 @@
+package serve
+
+import (
+	"encoding/json"
+	"image/png"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func get(t *testing.T, h http.Handler, path string, header http.Header) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestRender(t *testing.T) {
+	dir := t.TempDir()
+	h, err := New(Options{CacheDir: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := "/render.png?" + url.Values{"eq": {"x^2 + 1"}, "size": {"30"}, "bg": {"white"}}.Encode()
+
+	resp := get(t, h, path, nil)
+	if resp.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d: %s", resp.Code, http.StatusOK, resp.Body)
+	}
+	if ct := resp.Header().Get("Content-Type"); ct != "image/png" {
+		t.Errorf("Content-Type = %q, want image/png", ct)
+	}
+	etag := resp.Header().Get("ETag")
+	body := resp.Body.Bytes()
+	if _, err := png.Decode(resp.Body); err != nil {
+		t.Fatalf("decoding response: %v", err)
+	}
+
+	// A matching ETag should not return the image again.
+	if resp := get(t, h, path, http.Header{"If-None-Match": {etag}}); resp.Code != http.StatusNotModified {
+		t.Errorf("status with matching ETag = %d, want %d", resp.Code, http.StatusNotModified)
+	}
+	// Different options should render a different image.
+	if resp := get(t, h, path+"&padding=2", nil); resp.Header().Get("ETag") == etag {
+		t.Error("ETag did not change with the render options")
+	}
+	// Nearly equal sizes should share an image.
+	near := "/render.png?" + url.Values{"eq": {"x^2 + 1"}, "size": {"30.1"}, "bg": {"white"}}.Encode()
+	if resp := get(t, h, near, nil); resp.Header().Get("ETag") != etag {
+		t.Error("ETag changed for a nearly equal size")
+	}
+
+	// The image should be served from the disk cache by a new handler.
+	files, err := filepath.Glob(filepath.Join(dir, "*", "*"))
+	if err != nil || len(files) != 2 {
+		t.Fatalf("cache files = %v, want 2 (err = %v)", files, err)
+	}
+	for _, f := range files {
+		if err := ioutil.WriteFile(f, []byte("cached"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	h2, err := New(Options{CacheDir: dir, MemoryCacheBytes: -1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp := get(t, h2, path, nil); resp.Body.String() != "cached" {
+		t.Errorf("body = %q, want the cached image", resp.Body)
+	}
+	// The original handler should still serve the image from memory.
+	if resp := get(t, h, path, nil); !cmp.Equal(resp.Body.Bytes(), body) {
+		t.Error("image served from memory differed")
+	}
+}
+
+func TestErrors(t *testing.T) {
+	h, err := New(Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tcs := []struct {
+		name string
+		path string
+		code int
+		want Error
+	}{
+		{
+			name: "parse error",
+			path: "/render.png?" + url.Values{"eq": {"1 + 2)"}}.Encode(),
+			code: http.StatusBadRequest,
+			want: Error{Kind: "parse", Message: "unmatched end parenthesis", Position: 6, Length: 1},
+		},
+		{
+			name: "missing equation",
+			path: "/render.svg",
+			code: http.StatusBadRequest,
+			want: Error{Kind: "request", Message: "missing eq parameter"},
+		},
+		{
+			name: "blank equation",
+			path: "/render.png?eq=,",
+			code: http.StatusBadRequest,
+			want: Error{Kind: "request", Message: "missing eq parameter"},
+		},
+		{
+			name: "too deep",
+			path: "/render.png?" + url.Values{"eq": {strings.Repeat("(", 33) + "x" + strings.Repeat(")", 33)}}.Encode(),
+			code: http.StatusBadRequest,
+			want: Error{Kind: "request", Message: "equation nested more than 32 levels deep"},
+		},
+		{
+			name: "too large",
+			path: "/render.png?" + url.Values{"eq": {"[[" + strings.Repeat("1, ", 600) + "1]]"}, "size": {"256"}}.Encode(),
+			code: http.StatusBadRequest,
+			want: Error{Kind: "request", Message: "image larger than 8388608 pixels"},
+		},
+		{
+			name: "bad size",
+			path: "/render.png?eq=x&size=1000",
+			code: http.StatusBadRequest,
+			want: Error{Kind: "request", Message: "size must be a number between 1 and 256"},
+		},
+		{
+			name: "bad color",
+			path: "/render.png?eq=x&fg=nope",
+			code: http.StatusBadRequest,
+			want: Error{Kind: "request", Message: `fg: invalid color "nope"`},
+		},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			resp := get(t, h, tc.path, nil)
+			if resp.Code != tc.code {
+				t.Errorf("status = %d, want %d", resp.Code, tc.code)
+			}
+			if resp.Header().Get("ETag") != "" {
+				t.Error("error response had an ETag")
+			}
+			var got Error
+			if err := json.NewDecoder(resp.Body).Decode(&got); err != nil {
+				t.Fatalf("decoding response: %v", err)
+			}
+			if diff := cmp.Diff(got, tc.want); diff != "" {
+				t.Errorf("error differed:\n%s", diff)
+			}
+		})
+	}
+
+	if resp := get(t, h, "/other", nil); resp.Code != http.StatusNotFound {
+		t.Errorf("status for unknown path = %d, want %d", resp.Code, http.StatusNotFound)
+	}
+}
+
+func TestMemCache(t *testing.T) {
+	c := newMemCache(10)
+	c.put("a", []byte("1234"))
+	c.put("b", []byte("1234"))
+	c.get("a")
+	c.put("c", []byte("1234")) // Evicts b, the least recently used.
+	for key, want := range map[string]bool{"a": true, "b": false, "c": true} {
+		if _, ok := c.get(key); ok != want {
+			t.Errorf("get(%q) ok = %v, want %v", key, ok, want)
+		}
+	}
+	c.put("d", []byte("12345678901")) // Too large to cache.
+	if _, ok := c.get("d"); ok {
+		t.Error("oversized entry was cached")
+	}
+}
@@ -0,0 +1,27 @@
+package eqdraw
+
+import (
+	"image"
+
+	"golang.org/x/image/math/fixed"
+)
+
+// Sub represents a base term with a subscript index, and optionally an
+// exponent. The index and exponent are stacked on top of each other to the
+// right of the base.
+type Sub struct {
+	Base  Node
+	Index Node
+	// Exponent may be nil.
+	Exponent Node
+}
+
+// Layout is called during the layout pass to compute the rendered size of this node.
+func (s *Sub) Layout(dc *DrawContext) (*LayoutResult, error) {
+	return layoutScripts(dc, s, s.Base, s.Exponent, s.Index)
+}
+
+// Draw is called to render the base and its scripts.
+func (s *Sub) Draw(dc *DrawContext, pos fixed.Point26_6, clip image.Rectangle) error {
+	return drawScripts(dc, pos, clip, s, s.Base, s.Exponent, s.Index)
+}
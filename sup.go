@@ -0,0 +1,166 @@
+package eqdraw
+
+import (
+	"image"
+
+	"golang.org/x/image/math/fixed"
+)
+
+const (
+	// scriptScale is the ratio of the font size of a superscript or
+	// subscript, to the font size of its base.
+	scriptScale = 0.7
+	// scriptMinSize is the smallest font size scripts are shrunk to.
+	scriptMinSize = 6
+)
+
+// Script placement, in 26.6 fractions of an em (or of the script ascent,
+// for supDrop).
+const (
+	// supRaise is the minimum distance a superscript baseline is raised.
+	supRaise fixed.Int26_6 = 26 // ~0.4
+	// supDrop is how far below the top of a tall base the superscript
+	// baseline sits, relative to the ascent of the superscript.
+	supDrop fixed.Int26_6 = 48 // 0.75
+	// subLower is the minimum distance a subscript baseline is lowered.
+	subLower fixed.Int26_6 = 16 // 0.25
+	// scriptGap is the minimum distance between the baselines of a
+	// superscript and subscript on the same base.
+	scriptGap fixed.Int26_6 = 45 // ~0.7
+)
+
+var (
+	supMargin = LayoutResult{
+		Height: fixed.Int26_6(0 << 6),
+		Width:  fixed.Int26_6(1 << 6),
+	}
+)
+
+// scriptLayout describes the placement of a base term, and the superscript
+// and subscript stacked to its right.
+type scriptLayout struct {
+	// baseY, supY and subY are the distances the base, superscript and
+	// subscript are drawn below the top of the node.
+	baseY, supY, subY fixed.Int26_6
+}
+
+// layoutScripts lays out base at normal size, and sup and sub at script
+// size. Either of sup or sub may be nil. The placement of each is recorded
+// as the state of the node n.
+func layoutScripts(dc *DrawContext, n, base, sup, sub Node) (*LayoutResult, error) {
+	sz := supMargin
+
+	bb, err := dc.Layout(base)
+	if err != nil {
+		return nil, err
+	}
+	script := dc.scriptContext()
+
+	var (
+		em                 = dc.em()
+		ascent, descent    = bb.Ascent, bb.Descent()
+		scriptWidth        fixed.Int26_6
+		supShift, subShift fixed.Int26_6 // Distance from the baseline.
+		eb, ib             *LayoutResult
+	)
+	if sup != nil {
+		if eb, err = script.Layout(sup); err != nil {
+			return nil, err
+		}
+		// Raise the superscript by a fixed amount, or so it hangs off the
+		// top of a tall base.
+		supShift = em.Mul(supRaise)
+		if s := bb.Ascent - eb.Ascent.Mul(supDrop); s > supShift {
+			supShift = s
+		}
+		scriptWidth = eb.Width
+	}
+
+	if sub != nil {
+		if ib, err = script.Layout(sub); err != nil {
+			return nil, err
+		}
+		subShift = em.Mul(subLower)
+		// Keep the subscript clear of the superscript.
+		if sup != nil && supShift+subShift < em.Mul(scriptGap) {
+			subShift = em.Mul(scriptGap) - supShift
+		}
+		if ib.Width > scriptWidth {
+			scriptWidth = ib.Width
+		}
+	}
+
+	if eb != nil {
+		if a := supShift + eb.Ascent; a > ascent {
+			ascent = a
+		}
+		if d := eb.Descent() - supShift; d > descent {
+			descent = d
+		}
+	}
+	if ib != nil {
+		if a := ib.Ascent - subShift; a > ascent {
+			ascent = a
+		}
+		if d := subShift + ib.Descent(); d > descent {
+			descent = d
+		}
+	}
+
+	l := &scriptLayout{baseY: ascent - bb.Ascent}
+	if eb != nil {
+		l.supY = ascent - supShift - eb.Ascent
+	}
+	if ib != nil {
+		l.subY = ascent + subShift - ib.Ascent
+	}
+
+	sz.Width += bb.Width + scriptWidth
+	sz.Height += ascent + descent
+	sz.Ascent = supMargin.Height/2 + ascent
+	dc.states[n] = l
+	return &sz, nil
+}
+
+// drawScripts renders the base and scripts of the node n, as computed by
+// layoutScripts.
+func drawScripts(dc *DrawContext, pos fixed.Point26_6, clip image.Rectangle, n, base, sup, sub Node) error {
+	l := dc.states[n].(*scriptLayout)
+	pos.X += supMargin.Width / 2
+	pos.Y += supMargin.Height / 2
+
+	if err := base.Draw(dc, fixed.Point26_6{X: pos.X, Y: pos.Y + l.baseY}, clip); err != nil {
+		return err
+	}
+	pos.X += dc.Bounds(base).Width
+
+	script := dc.scriptContext()
+	script.c, script.fg = dc.c, dc.fg
+	if sup != nil {
+		if err := sup.Draw(script, fixed.Point26_6{X: pos.X, Y: pos.Y + l.supY}, clip); err != nil {
+			return err
+		}
+	}
+	if sub != nil {
+		if err := sub.Draw(script, fixed.Point26_6{X: pos.X, Y: pos.Y + l.subY}, clip); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Sup represents a base term raised to an exponent.
+type Sup struct {
+	Base     Node
+	Exponent Node
+}
+
+// Layout is called during the layout pass to compute the rendered size of this node.
+func (s *Sup) Layout(dc *DrawContext) (*LayoutResult, error) {
+	return layoutScripts(dc, s, s.Base, s.Exponent, nil)
+}
+
+// Draw is called to render the base and its exponent.
+func (s *Sup) Draw(dc *DrawContext, pos fixed.Point26_6, clip image.Rectangle) error {
+	return drawScripts(dc, pos, clip, s, s.Base, s.Exponent, nil)
+}
@@ -0,0 +1,136 @@
+package eqdraw
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+	"strconv"
+
+	"golang.org/x/image/math/fixed"
+)
+
+// svgCanvas draws into an SVG document, converting each glyph into a path
+// outlining its shape.
+type svgCanvas struct {
+	buf bytes.Buffer
+	// clips maps each rectangle which paths have been clipped to, to the
+	// id of its <clipPath> element.
+	clips map[image.Rectangle]string
+}
+
+func svgNum(v float64) string {
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
+
+// svgFill returns the attributes to fill a shape with the given color.
+func svgFill(c color.Color) string {
+	r, g, b, a := c.RGBA()
+	if a == 0 {
+		return `fill="none"`
+	}
+	// Un-premultiply the color components.
+	r, g, b = r*0xffff/a, g*0xffff/a, b*0xffff/a
+	out := fmt.Sprintf(`fill="#%02x%02x%02x"`, r>>8, g>>8, b>>8)
+	if a != 0xffff {
+		out += ` fill-opacity="` + svgNum(float64(a)/0xffff) + `"`
+	}
+	return out
+}
+
+// Glyph implements Canvas.
+func (sc *svgCanvas) Glyph(f *Face, dot fixed.Point26_6, r rune, c color.Color, clip image.Rectangle) (fixed.Int26_6, bool) {
+	p, advance, ok := f.GlyphPath(dot, r)
+	if !ok {
+		return 0, false
+	}
+	if len(p) > 0 {
+		sc.FillPath(p, c, clip)
+	}
+	return advance, true
+}
+
+// clipPath returns the attribute which clips a shape with bounds b to the
+// rectangle clip, or an empty string if the shape lies within clip. If the
+// shape lies outside clip, ok is false and the shape should not be drawn.
+func (sc *svgCanvas) clipPath(b, clip image.Rectangle) (attr string, ok bool) {
+	switch {
+	case !b.Overlaps(clip):
+		return "", false
+	case b.In(clip):
+		return "", true
+	}
+	id, ok := sc.clips[clip]
+	if !ok {
+		if sc.clips == nil {
+			sc.clips = map[image.Rectangle]string{}
+		}
+		id = "clip" + strconv.Itoa(len(sc.clips))
+		sc.clips[clip] = id
+		fmt.Fprintf(&sc.buf, `<clipPath id="%s"><rect x="%d" y="%d" width="%d" height="%d"/></clipPath>`+"\n", id, clip.Min.X, clip.Min.Y, clip.Dx(), clip.Dy())
+	}
+	return ` clip-path="url(#` + id + `)"`, true
+}
+
+// FillPath implements Canvas.
+func (sc *svgCanvas) FillPath(p Path, c color.Color, clip image.Rectangle) {
+	pt := func(p fixed.Point26_6) string {
+		return svgNum(float64(p.X)/64) + " " + svgNum(float64(p.Y)/64)
+	}
+	attr, ok := sc.clipPath(p.bounds(), clip)
+	if !ok {
+		return
+	}
+
+	sc.buf.WriteString(`<path d="`)
+	for _, s := range p {
+		switch s.Op {
+		case PathMoveTo:
+			sc.buf.WriteString("M" + pt(s.Pts[0]))
+		case PathLineTo:
+			sc.buf.WriteString("L" + pt(s.Pts[0]))
+		case PathQuadTo:
+			sc.buf.WriteString("Q" + pt(s.Pts[0]) + " " + pt(s.Pts[1]))
+		case PathClose:
+			sc.buf.WriteString("Z")
+		}
+	}
+	sc.buf.WriteString(`" ` + svgFill(c) + attr + "/>\n")
+}
+
+// FillRect implements Canvas.
+func (sc *svgCanvas) FillRect(r image.Rectangle, c color.Color, clip image.Rectangle) {
+	r = r.Intersect(clip)
+	if r.Empty() {
+		return
+	}
+	fmt.Fprintf(&sc.buf, `<rect x="%d" y="%d" width="%d" height="%d" %s/>`+"\n", r.Min.X, r.Min.Y, r.Dx(), r.Dy(), svgFill(c))
+}
+
+// DrawSVG writes an SVG document to w by drawing the given node. The
+// document has the same dimensions and layout as the image DrawRGBA would
+// generate, but glyphs and lines are drawn as vector shapes. If bg is
+// non-nil, it is drawn over the entire document before the equation.
+func (r *Renderer) DrawSVG(w io.Writer, n Node, fg, bg *image.Uniform) error {
+	dc := r.newContext()
+	defer r.release(dc)
+	bounds, err := dc.layout(n)
+	if err != nil {
+		return err
+	}
+
+	sc := svgCanvas{}
+	fmt.Fprintf(&sc.buf, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d">`+"\n",
+		bounds.Dx(), bounds.Dy(), bounds.Dx(), bounds.Dy())
+	if bg != nil {
+		sc.FillRect(bounds, bg.C, bounds)
+	}
+	if err := dc.render(&sc, n, fg, bounds); err != nil {
+		return err
+	}
+	sc.buf.WriteString("</svg>\n")
+
+	_, err = sc.buf.WriteTo(w)
+	return err
+}
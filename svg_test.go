@@ -0,0 +1,134 @@
+package eqdraw
+
+import (
+	"bytes"
+	"encoding/xml"
+	"image"
+	"image/color"
+	"io"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/golang/freetype/truetype"
+	"golang.org/x/image/math/fixed"
+)
+
+func TestDrawSVG(t *testing.T) {
+	tcs := []struct {
+		name         string
+		Node         Node
+		paths, rects int
+	}{
+		{
+			"term",
+			&Term{Content: []rune{'h', 'e', 'l', 'l', 'o'}},
+			5, 1,
+		},
+		{
+			"div",
+			&Div{Numerator: &Term{Content: []rune{'1'}}, Denominator: &Term{Content: []rune{'2', 'a'}}},
+			3, 2,
+		},
+		{
+			"root_sup",
+			&Root{Term: &Sup{
+				Base:     &Term{Content: []rune{'x'}},
+				Exponent: &Term{Content: []rune{'2'}},
+			}},
+			5, 1, // surd, 2 macrons, base & exponent.
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			r, err := NewRenderer(truetype.Options{Size: 24}, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var buf bytes.Buffer
+			if err := r.DrawSVG(&buf, tc.Node, image.NewUniform(color.RGBA{A: 255, R: 255}), image.NewUniform(color.White)); err != nil {
+				t.Fatalf("DrawSVG() failed: %v", err)
+			}
+			img, err := r.DrawRGBA(tc.Node, nil, nil)
+			if err != nil {
+				t.Fatalf("DrawRGBA() failed: %v", err)
+			}
+
+			var (
+				d            = xml.NewDecoder(&buf)
+				paths, rects int
+			)
+			for {
+				tok, err := d.Token()
+				if err == io.EOF {
+					break
+				}
+				if err != nil {
+					t.Fatalf("invalid SVG: %v", err)
+				}
+				se, ok := tok.(xml.StartElement)
+				if !ok {
+					continue
+				}
+				switch se.Name.Local {
+				case "svg":
+					want := map[string]string{
+						"width":  strconv.Itoa(img.Bounds().Dx()),
+						"height": strconv.Itoa(img.Bounds().Dy()),
+					}
+					for _, a := range se.Attr {
+						if w, ok := want[a.Name.Local]; ok && w != a.Value {
+							t.Errorf("svg %s = %q, want %q", a.Name.Local, a.Value, w)
+						}
+					}
+				case "path":
+					paths++
+				case "rect":
+					rects++
+				}
+			}
+
+			if paths != tc.paths {
+				t.Errorf("got %d paths, want %d", paths, tc.paths)
+			}
+			if rects != tc.rects {
+				t.Errorf("got %d rects, want %d", rects, tc.rects)
+			}
+		})
+	}
+}
+
+func TestSVGClip(t *testing.T) {
+	r, err := NewRenderer(truetype.Options{Size: 24}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dc := r.newContext()
+	defer r.release(dc)
+	f := dc.Face(StyleRegular)
+
+	tcs := []struct {
+		name            string
+		clip            image.Rectangle
+		paths, clipRefs int
+	}{
+		{"inside", image.Rect(0, 0, 100, 100), 1, 0},
+		{"partly outside", image.Rect(0, 0, 5, 100), 1, 1},
+		{"outside", image.Rect(50, 50, 60, 60), 0, 0},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			var sc svgCanvas
+			sc.Glyph(f, fixed.P(0, 30), 'x', color.Black, tc.clip)
+			out := sc.buf.String()
+			if got := strings.Count(out, "<path "); got != tc.paths {
+				t.Errorf("got %d paths, want %d:\n%s", got, tc.paths, out)
+			}
+			if got := strings.Count(out, "clip-path="); got != tc.clipRefs {
+				t.Errorf("got %d clipped paths, want %d:\n%s", got, tc.clipRefs, out)
+			}
+		})
+	}
+}
@@ -3,7 +3,6 @@ package eqdraw
 import (
 	"image"
 	"image/color"
-	"image/draw"
 
 	"golang.org/x/image/math/fixed"
 )
@@ -13,7 +12,7 @@ const (
 )
 
 var (
-	termMargin = layoutResult{
+	termMargin = LayoutResult{
 		Height: fixed.Int26_6(3 << 6),
 		Width:  fixed.Int26_6(6 << 6),
 	}
@@ -21,77 +20,79 @@ var (
 
 // Term represents a run of text to be rendered.
 type Term struct {
-	layout  *layoutResult
 	Content []rune
+	// Style selects the font the term is drawn in.
+	Style FontStyle
 }
 
-// Bounds returns the width and height of the rendered term, as computed by
-// the last layout pass. If no layout pass has occurred, the returned value
-// will be nil.
-func (t *Term) Bounds() *layoutResult {
-	return t.layout
+// face returns the face to draw the rune c with.
+func (t *Term) face(dc *DrawContext, c rune) *Face {
+	if t.Style == StyleAuto && c >= 'a' && c <= 'z' {
+		return dc.faces[StyleItalic]
+	}
+	return dc.faces[t.Style]
 }
 
 // Layout is called during the layout pass to compute the rendered size of this node.
-func (t *Term) Layout(dc *DrawContext) error {
+func (t *Term) Layout(dc *DrawContext) (*LayoutResult, error) {
 	var (
-		prevC = rune(-1)
-		w     = fixed.Int26_6(0)
+		prevC  = rune(-1)
+		prevFF *Face
+		w      = fixed.Int26_6(0)
 	)
 	for i := 0; i < len(t.Content); i++ {
 		c := t.Content[i]
-		ff := dc.ff
-		if c >= 'a' && c <= 'z' {
-			ff = dc.ffi
+		ff, ok := dc.glyphFace(t.face(dc, c), c)
+		if !ok && dc.strict {
+			return nil, &MissingGlyphError{Rune: c, Pos: i, Term: string(t.Content)}
 		}
 
 		var kern fixed.Int26_6
-		if prevC >= 0 {
+		if prevC >= 0 && prevFF == ff {
 			kern = ff.Kern(prevC, c)
 		}
 		a, ok := ff.GlyphAdvance(c)
 		if !ok {
 			continue
 		}
-		prevC = c
+		prevC, prevFF = c, ff
 		w += a + kern
 	}
 
-	t.layout = &layoutResult{
-		Height: dc.ff.Metrics().Height + termMargin.Height,
+	return &LayoutResult{
+		Height: dc.faces[t.Style].Metrics().Height + termMargin.Height,
 		Width:  w + termMargin.Width,
-	}
-
-	return nil
+		Ascent: dc.faces[t.Style].Metrics().Ascent + termMargin.Height/2,
+	}, nil
 }
 
 // Draw is called to render the term.
 func (t *Term) Draw(dc *DrawContext, pos fixed.Point26_6, clip image.Rectangle) error {
 	pos.X += termMargin.Width / 2
-	pos.Y += dc.ff.Metrics().Ascent + termMargin.Height/2
+	pos.Y += dc.faces[t.Style].Metrics().Ascent + termMargin.Height/2
 
-	prevC := rune(-1)
+	var (
+		prevC  = rune(-1)
+		prevFF *Face
+	)
 	for i := 0; i < len(t.Content); i++ {
 		c := t.Content[i]
-		ff := dc.ff
-		if c >= 'a' && c <= 'z' {
-			ff = dc.ffi
-		}
+		ff, _ := dc.glyphFace(t.face(dc, c), c)
 
-		if prevC >= 0 {
+		if prevC >= 0 && prevFF == ff {
 			pos.X += ff.Kern(prevC, c)
 		}
-		dr, mask, maskp, advance, ok := ff.Glyph(pos, c)
+		if termRenderBlocks {
+			if b, _, ok := ff.GlyphBounds(c); ok {
+				dc.c.FillRect(glyphRect(b, pos), color.RGBA{A: 100}, clip)
+			}
+		}
+		advance, ok := dc.c.Glyph(ff, pos, c, dc.fg.C, clip)
 		if !ok {
 			continue
 		}
-		if termRenderBlocks {
-			mask = image.NewUniform(color.RGBA{A: 100})
-		}
-
-		draw.DrawMask(dc.out, dr.Intersect(clip), dc.fg, image.Point{}, mask, maskp, draw.Over)
 		pos.X += advance
-		prevC = c
+		prevC, prevFF = c, ff
 	}
 
 	return nil